@@ -2,12 +2,14 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"qrstreamer/internal/handler"
 	"qrstreamer/internal/provider"
+	"qrstreamer/internal/repository"
 	"qrstreamer/internal/routes"
 	"qrstreamer/internal/service"
 	"qrstreamer/model/constant"
@@ -18,6 +20,11 @@ import (
 	"google.golang.org/grpc/connectivity"
 )
 
+const defaultShutdownGrace = 15 * time.Second
+
+// devHS256Secret adalah secret pengembangan yang dikirim di config.yaml
+const devHS256Secret = "dev-only-change-me"
+
 func Run(cfg *util.Config) {
 	ctx := context.WithValue(context.Background(), constant.CtxReqIDKey, "MAIN")
 
@@ -29,13 +36,44 @@ func Run(cfg *util.Config) {
 		return
 	}
 
+	db, err := provider.NewPostgresConnection(ctx)
+	if err != nil {
+		logger.Errorfctx(provider.AppLog, ctx, false, "Failed connect to Postgres: %v", err)
+		return
+	}
+	defer db.Close()
+
+	var verifier *provider.JWTVerifier
+	switch {
+	case cfg.Auth.Enabled:
+		verifier, err = provider.NewJWTVerifier()
+		if err != nil {
+			logger.Errorfctx(provider.AppLog, ctx, false, "Failed to load JWT verifier: %v", err)
+			return
+		}
+		if cfg.Auth.HS256Secret == devHS256Secret {
+			logger.Errorfctx(provider.AppLog, ctx, false, "WARNING: auth.hs256_secret is the shipped development secret, anyone can mint tokens. Replace it before deploying")
+		}
+	case cfg.Auth.DevTrustUserHeader:
+		logger.Errorfctx(provider.AppLog, ctx, false, "WARNING: auth is disabled and auth.dev_trust_user_header is set. Any caller can act as any user via ?user_id= or the User-ID header. Never run this outside local development")
+	default:
+		logger.Errorfctx(provider.AppLog, ctx, false, "Auth is disabled but auth.dev_trust_user_header is not set, refusing to start without a way to identify users")
+		return
+	}
+
 	logger.Infofctx(provider.AppLog, ctx, "Application started")
 
 	app := handler.NewApp(logger)
-	hub := handler.NewHub(logger)
-	svc := service.NewService(logger, hub, app, redis)
+	hub := handler.NewHub(logger, redis, cfg.Websocket.MaxViewers)
+	accounts := repository.NewAccountRepository(logger, db)
+	events := repository.NewAccountEventRepository(logger, db)
+	svc := service.NewService(logger, hub, app, redis, accounts, events)
+	outbounds := repository.NewOutboundRepository(logger, db)
+	gw := service.NewGateway(logger, app, redis, outbounds)
 
-	go hub.Run()
+	hubCtx, stopHub := context.WithCancel(ctx)
+	defer stopHub()
+	go hub.Run(hubCtx)
 
 	go func() {
 		// Setup gRPC client connection
@@ -86,11 +124,13 @@ func Run(cfg *util.Config) {
 		}
 	}()
 
+	server := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Websocket.Port)}
+
 	go func() {
 		// Start WS HTTP server
-		routes.RegisterRoutes(hub, svc)
+		routes.RegisterRoutes(hub, svc, gw, verifier)
 		logger.Infofctx(provider.AppLog, ctx, "Websocket Server started on :%d", cfg.Websocket.Port)
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Websocket.Port), nil); err != nil {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Errorfctx(provider.AppLog, ctx, false, "Failed to start Websocket Server: %v", err)
 		}
 	}()
@@ -102,6 +142,26 @@ func Run(cfg *util.Config) {
 	logger.Infofctx(provider.AppLog, ctx, "Receiving signal: %s", sig)
 
 	func(logger provider.ILogger) {
+		grace := util.ConfigSeconds(cfg.Websocket.ShutdownGrace, defaultShutdownGrace)
+		shutdownCtx, cancel := context.WithTimeout(ctx, grace)
+		defer cancel()
+
+		// Batalkan stream QR agar state pairing tercatat dan lease dilepas
+		if err := svc.Shutdown(shutdownCtx); err != nil {
+			logger.Errorfctx(provider.AppLog, ctx, false, "Failed to stop QR streams: %v", err)
+		}
+
+		// Kirim server_shutdown ke semua client lebih dulu, koneksi SSE tidak
+		// di-hijack sehingga server.Shutdown menunggunya selesai
+		if err := hub.Shutdown(shutdownCtx); err != nil {
+			logger.Errorfctx(provider.AppLog, ctx, false, "Failed to stop Hub: %v", err)
+		}
+
+		// Berhenti menerima koneksi baru dan tunggu request REST selesai
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Errorfctx(provider.AppLog, ctx, false, "Failed to stop Websocket Server: %v", err)
+		}
+		stopHub()
 
 		logger.Infofctx(provider.AppLog, ctx, "Successfully stop Application.")
 	}(logger)
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"qrstreamer/internal/provider"
+	"qrstreamer/util"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Kebijakan saat antrean kirim client penuh, diatur lewat websocket.slow_consumer_policy
+const (
+	// PolicyDisconnect menutup koneksi client dengan close code 1008
+	PolicyDisconnect = "disconnect"
+	// PolicyDropOldest membuang pesan tertua di antrean untuk memberi ruang pesan baru
+	PolicyDropOldest = "drop_oldest"
+	// PolicyCoalesce membuang QR lama di antrean sehingga hanya QR terbaru yang dikirim
+	PolicyCoalesce = "coalesce"
+)
+
+const (
+	defaultSendBuffer = 256
+
+	closeTextSlowConsumer = "slow consumer"
+)
+
+// sendBuffer mengembalikan kapasitas antrean kirim per client dari websocket.send_buffer
+func sendBuffer() int {
+	if size := util.Configuration.Websocket.SendBuffer; size > 0 {
+		return size
+	}
+	return defaultSendBuffer
+}
+
+// slowConsumerPolicy mengembalikan kebijakan dari websocket.slow_consumer_policy, default disconnect
+func slowConsumerPolicy() string {
+	switch policy := strings.ToLower(util.Configuration.Websocket.SlowConsumerPolicy); policy {
+	case PolicyDropOldest, PolicyCoalesce:
+		return policy
+	}
+	return PolicyDisconnect
+}
+
+// enqueue memasukkan payload ke antrean kirim client dan menerapkan kebijakan
+// slow consumer jika antrean penuh. Mengembalikan false jika client sudah
+// ditutup atau diputus. Caller harus memegang h.mu.
+func (h *Hub) enqueue(client *Client, payload []byte) bool {
+	if client.closed {
+		return false
+	}
+
+	select {
+	case client.send <- payload:
+		return true
+	default:
+	}
+
+	switch slowConsumerPolicy() {
+	case PolicyCoalesce:
+		if h.coalesce(client, payload) {
+			return true
+		}
+		// Tidak ada QR lama yang bisa dibuang, perlakukan seperti drop_oldest
+		fallthrough
+	case PolicyDropOldest:
+		select {
+		case <-client.send:
+			client.dropped.Add(1)
+		default:
+		}
+		select {
+		case client.send <- payload:
+		default:
+			client.dropped.Add(1)
+		}
+		h.logger.Debugfctx(provider.AppLog, client.ctx, "Send queue full for ID: %s, Address: %s, dropped: %d", client.id, client.transport.RemoteAddr(), client.dropped.Load())
+		return true
+	default:
+		client.dropped.Add(1)
+		h.logger.Infofctx(provider.AppLog, client.ctx, "Send queue full for ID: %s, disconnecting slow consumer Address: %s", client.id, client.transport.RemoteAddr())
+		h.closeClient(client, websocket.ClosePolicyViolation, closeTextSlowConsumer)
+		return false
+	}
+}
+
+// coalesce mengosongkan antrean, membuang QR yang sudah digantikan QR yang
+// lebih baru, lalu mengantrekan ulang sisanya bersama payload. Mengembalikan
+// false jika tidak ada pesan yang bisa dibuang. Caller harus memegang h.mu.
+func (h *Hub) coalesce(client *Client, payload []byte) bool {
+	queued := make([][]byte, 0, cap(client.send))
+drain:
+	for {
+		select {
+		case msg := <-client.send:
+			queued = append(queued, msg)
+		default:
+			break drain
+		}
+	}
+	queued = append(queued, payload)
+
+	// Pertahankan hanya QR terakhir, pesan lain tetap dikirim berurutan
+	lastQR := -1
+	for i, msg := range queued {
+		if isQRPayload(msg) {
+			lastQR = i
+		}
+	}
+
+	kept := queued[:0]
+	for i, msg := range queued {
+		if i != lastQR && isQRPayload(msg) {
+			client.dropped.Add(1)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	coalesced := len(kept) < len(queued)
+	if !coalesced {
+		// Payload diserahkan ke drop_oldest oleh caller
+		kept = kept[:len(kept)-1]
+	}
+
+	for _, msg := range kept {
+		select {
+		case client.send <- msg:
+		default:
+			client.dropped.Add(1)
+		}
+	}
+	return coalesced
+}
+
+// isQRPayload menentukan apakah payload adalah pesan qr_code
+func isQRPayload(payload []byte) bool {
+	if !bytes.Contains(payload, []byte(`"qr_code"`)) {
+		return false
+	}
+	var message struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(payload, &message) == nil && message.Type == "qr_code"
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"time"
+)
+
+var (
+	// ErrInvalidCommand dikembalikan saat frame dari client bukan WSCommand yang valid
+	ErrInvalidCommand = errors.New("invalid command")
+	// ErrUnknownCommand dikembalikan saat tipe command tidak memiliki handler
+	ErrUnknownCommand = errors.New("unknown command")
+)
+
+// CommandHandler menjalankan satu command dari client. Nilai yang dikembalikan
+// dikirim sebagai data ack, error dikirim sebagai balasan error.
+type CommandHandler func(client *Client, cmd model.WSCommand) (any, error)
+
+// defaultCommands adalah command yang dilayani Hub tanpa bantuan service
+func defaultCommands() map[string]CommandHandler {
+	return map[string]CommandHandler{
+		model.WSCommandPing: func(client *Client, cmd model.WSCommand) (any, error) {
+			return "pong", nil
+		},
+	}
+}
+
+// HandleCommand mendaftarkan handler untuk tipe command. Harus dipanggil sebelum
+// server HTTP menerima koneksi karena readPump membaca handler tanpa lock.
+func (h *Hub) HandleCommand(command string, handler CommandHandler) {
+	h.commands[command] = handler
+}
+
+// dispatchCommand mem-parsing frame dari client lalu mengirim ack atau error ke client tersebut
+func (h *Hub) dispatchCommand(client *Client, message []byte) {
+	var cmd model.WSCommand
+	if err := json.Unmarshal(message, &cmd); err != nil || cmd.Type == "" {
+		h.replyCommand(client, cmd, nil, ErrInvalidCommand)
+		return
+	}
+	if cmd.RequestId == "" {
+		h.replyCommand(client, cmd, nil, errors.New("request_id is required"))
+		return
+	}
+	if cmd.WhatsappId == "" {
+		cmd.WhatsappId = client.id
+	}
+
+	handler, ok := h.commands[cmd.Type]
+	if !ok {
+		h.replyCommand(client, cmd, nil, ErrUnknownCommand)
+		return
+	}
+
+	data, err := handler(client, cmd)
+	h.replyCommand(client, cmd, data, err)
+}
+
+// replyCommand mengirim balasan command ke client jika koneksinya masih terbuka
+func (h *Hub) replyCommand(client *Client, cmd model.WSCommand, data any, err error) {
+	reply := model.WSCommandReply{
+		MsgStatus:  err == nil,
+		Type:       model.WSReplyAck,
+		RequestId:  cmd.RequestId,
+		Command:    cmd.Type,
+		WhatsappId: cmd.WhatsappId,
+		Data:       data,
+		Timestamp:  time.Now(),
+	}
+	if err != nil {
+		reply.Type = model.WSReplyError
+		reply.Error = err.Error()
+	}
+
+	msgBytes, mErr := json.Marshal(reply)
+	if mErr != nil {
+		h.logger.Errorfctx(provider.AppLog, client.ctx, false, "Error marshal command reply: %v", mErr)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.enqueue(client, msgBytes)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"strings"
+)
+
+const keyControlChannelPrefix = "wsctl:"
+
+// controlChannel mengembalikan channel Pub/Sub untuk perintah ke replica pemegang stream whatsappID
+func controlChannel(whatsappID string) string {
+	return keyControlChannelPrefix + whatsappID
+}
+
+// controlWatch adalah handler perintah kontrol yang didaftarkan WatchControl
+type controlWatch struct {
+	handle func(command string)
+}
+
+// WatchControl menjalankan handle untuk setiap perintah yang dikirim ke
+// channel kontrol whatsappID lewat koneksi Pub/Sub bersama milik Hub.
+// Satu whatsappID hanya punya satu handler; pendaftaran baru menggantikan
+// yang lama. Panggil fungsi yang dikembalikan untuk berhenti mendengarkan.
+func (h *Hub) WatchControl(whatsappID string, handle func(command string)) func() {
+	watch := &controlWatch{handle: handle}
+
+	h.mu.Lock()
+	h.controls[whatsappID] = watch
+	h.notifySubscriptions()
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// Jangan hapus handler pengganti milik stream berikutnya
+		if h.controls[whatsappID] == watch {
+			delete(h.controls, whatsappID)
+			h.notifySubscriptions()
+		}
+	}
+}
+
+// PublishControl mengirim perintah ke replica yang mendengarkan channel
+// kontrol whatsappID dan mengembalikan jumlah penerimanya
+func (h *Hub) PublishControl(ctx context.Context, whatsappID string, command string) (int64, error) {
+	return h.redis.Publish(ctx, controlChannel(whatsappID), command).Result()
+}
+
+// dispatchControl meneruskan perintah dari channel kontrol ke handler lokal.
+// Handler dipanggil di luar h.mu.
+func (h *Hub) dispatchControl(channel string, command string) {
+	whatsappID := strings.TrimPrefix(channel, keyControlChannelPrefix)
+
+	h.mu.Lock()
+	watch := h.controls[whatsappID]
+	h.mu.Unlock()
+
+	if watch != nil {
+		watch.handle(command)
+	}
+}
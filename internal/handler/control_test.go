@@ -0,0 +1,30 @@
+package handler
+
+import "testing"
+
+func TestWatchControlDispatch(t *testing.T) {
+	h := newTestHub(t)
+
+	var first, second []string
+	stopFirst := h.WatchControl("wa-1", func(command string) { first = append(first, command) })
+	h.dispatchControl(controlChannel("wa-1"), "cancel")
+	h.dispatchControl(controlChannel("wa-2"), "cancel")
+
+	// Stream berikutnya menggantikan handler, stop milik stream lama tidak boleh menghapusnya
+	stopSecond := h.WatchControl("wa-1", func(command string) { second = append(second, command) })
+	stopFirst()
+	h.dispatchControl(controlChannel("wa-1"), "cancel")
+
+	stopSecond()
+	h.dispatchControl(controlChannel("wa-1"), "cancel")
+
+	if len(first) != 1 {
+		t.Fatalf("first handler got %v, want one cancel", first)
+	}
+	if len(second) != 1 {
+		t.Fatalf("second handler got %v, want one cancel", second)
+	}
+	if len(h.controls) != 0 {
+		t.Fatalf("controls not cleared: %v", h.controls)
+	}
+}
@@ -2,14 +2,18 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"qrstreamer/internal/provider"
 	proto "qrstreamer/model/pb"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// ErrGRPCNotConnected dikembalikan saat client gRPC wacore belum terhubung
+var ErrGRPCNotConnected = errors.New("gRPC client not connected")
+
 type App struct {
 	log        provider.ILogger
 	grpcClient proto.WaCoreGatewayClient
@@ -67,9 +71,45 @@ func (a *App) IsGRPCConnected() bool {
 // Example method to stream connect device
 func (a *App) StreamConnectDevice(ctx context.Context, connectRequest *proto.ConnectDeviceRequest) (proto.WaCoreGateway_StreamConnectDeviceClient, error) {
 	if !a.IsGRPCConnected() {
-		return nil, fmt.Errorf("gRPC client not connected")
+		return nil, ErrGRPCNotConnected
 	}
 
 	stream, err := a.grpcClient.StreamConnectDevice(ctx, connectRequest)
 	return stream, err
 }
+
+// GetClientContact returns the contacts of a sender JID from wacore
+func (a *App) GetClientContact(ctx context.Context, senderJid string) (*proto.ContactListResponse, error) {
+	if !a.IsGRPCConnected() {
+		return nil, ErrGRPCNotConnected
+	}
+
+	return a.grpcClient.GetClientContact(ctx, &proto.ClientdataRequest{SenderJid: senderJid})
+}
+
+// GetClientGroup returns the groups of a sender JID from wacore
+func (a *App) GetClientGroup(ctx context.Context, senderJid string) (*proto.GroupListResponse, error) {
+	if !a.IsGRPCConnected() {
+		return nil, ErrGRPCNotConnected
+	}
+
+	return a.grpcClient.GetClientGroup(ctx, &proto.ClientdataRequest{SenderJid: senderJid})
+}
+
+// GetAllDevice returns every device registered in wacore
+func (a *App) GetAllDevice(ctx context.Context) (*proto.DeviceListResponse, error) {
+	if !a.IsGRPCConnected() {
+		return nil, ErrGRPCNotConnected
+	}
+
+	return a.grpcClient.GetAllDevice(ctx, &emptypb.Empty{})
+}
+
+// SendMessage relays a message payload to wacore
+func (a *App) SendMessage(ctx context.Context, payload *proto.MessagePayload) (*proto.MessageResponse, error) {
+	if !a.IsGRPCConnected() {
+		return nil, ErrGRPCNotConnected
+	}
+
+	return a.grpcClient.SendMessage(ctx, payload)
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"qrstreamer/internal/provider"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestHub membuat Hub dengan Redis yang tidak bisa dihubungi. Hub tetap
+// bisa mendaftarkan dan menutup client karena keduanya tidak butuh Redis.
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	return NewHub(nopLogger{}, rdb, 0)
+}
+
+// payloadType membaca field type dari payload WSMessage
+func payloadType(payload string) string {
+	var message struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal([]byte(payload), &message)
+	return message.Type
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(logType provider.LogType, format string, args ...interface{}) {}
+func (nopLogger) Infofctx(logType provider.LogType, ctx context.Context, format string, args ...interface{}) {
+}
+func (nopLogger) Errorf(logType provider.LogType, format string, args ...interface{}) {}
+func (nopLogger) Errorfctx(logType provider.LogType, ctx context.Context, addStackTrace bool, format string, args ...interface{}) {
+}
+func (nopLogger) Debugf(logType provider.LogType, format string, args ...interface{}) {}
+func (nopLogger) Debugfctx(logType provider.LogType, ctx context.Context, format string, args ...interface{}) {
+}
+func (nopLogger) WithFields(logType provider.LogType, fields logrus.Fields) *logrus.Entry {
+	return logrus.NewEntry(logrus.New())
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"qrstreamer/util"
+	"time"
+)
+
+const (
+	defaultWSPongWait       = 60 * time.Second
+	defaultWSWriteWait      = 10 * time.Second
+	defaultWSMaxMessageSize = 4096
+)
+
+// wsPongWait mengembalikan batas waktu menunggu pong dari websocket.pong_wait
+func wsPongWait() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Websocket.PongWait, defaultWSPongWait)
+}
+
+// wsPingInterval mengembalikan jeda ping dari websocket.ping_interval. Jika tidak
+// diset atau tidak lebih pendek dari pong_wait, dipakai 9/10 dari pong_wait.
+func wsPingInterval() time.Duration {
+	pongWait := wsPongWait()
+	interval := util.ConfigSeconds(util.Configuration.Websocket.PingInterval, 0)
+	if interval <= 0 || interval >= pongWait {
+		interval = pongWait * 9 / 10
+	}
+	return interval
+}
+
+// wsWriteWait mengembalikan batas waktu menulis satu frame dari websocket.write_wait
+func wsWriteWait() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Websocket.WriteWait, defaultWSWriteWait)
+}
+
+// wsMaxMessageSize mengembalikan ukuran maksimum frame masuk dari websocket.max_message_size
+func wsMaxMessageSize() int64 {
+	if size := util.Configuration.Websocket.MaxMessageSize; size > 0 {
+		return size
+	}
+	return defaultWSMaxMessageSize
+}
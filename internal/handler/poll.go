@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollTimeout    = 30 * time.Second
+	defaultPollMaxTimeout = 60 * time.Second
+	defaultPollLinger     = 10 * time.Second
+)
+
+// ErrInvalidPollTimeout dikembalikan saat ?timeout= tidak bisa dibaca
+var ErrInvalidPollTimeout = errors.New("invalid timeout, use a duration such as 30s")
+
+// pollTransport menampung pesan untuk client poll. Pesan yang datang setelah
+// response dikirim tetap ditampung untuk poll berikutnya yang memakai ulang
+// client ini selama poll.linger.
+type pollTransport struct {
+	remoteAddr string
+
+	mu     sync.Mutex
+	batch  [][]byte
+	ready  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (t *pollTransport) Name() string {
+	return "poll"
+}
+
+func (t *pollTransport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+func (t *pollTransport) WriteMessage(payload []byte) error {
+	// ws_state dikirim setiap registrasi dan tidak boleh mengakhiri poll
+	var message struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(payload, &message) == nil && message.Type == "ws_state" {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.batch = append(t.batch, payload)
+	select {
+	case t.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// WritePing tidak melakukan apa pun, umur koneksi poll dibatasi timeout
+func (t *pollTransport) WritePing() error {
+	return nil
+}
+
+// WriteClose tidak melakukan apa pun, Close mengakhiri poll yang sedang menunggu
+func (t *pollTransport) WriteClose(code int, text string) error {
+	return nil
+}
+
+func (t *pollTransport) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
+
+// take mengambil dan mengosongkan pesan yang terkumpul
+func (t *pollTransport) take() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	batch := t.batch
+	t.batch = nil
+	return batch
+}
+
+// pollKey mengidentifikasi poll lanjutan dari browser yang sama: pemilik,
+// whatsappID dan cursor yang dikembalikan poll sebelumnya
+type pollKey struct {
+	owner      string
+	whatsappID string
+	cursor     int64
+}
+
+// Poll adalah satu request long polling yang terdaftar di Hub sebagai client
+type Poll struct {
+	hub       *Hub
+	client    *Client
+	transport *pollTransport
+	owner     string
+	since     int64
+	first     bool
+
+	// linger melepas client dari Hub jika tidak ada poll lanjutan. Dijaga oleh Hub.mu.
+	linger *time.Timer
+}
+
+// OpenPoll mendaftarkan request GET /poll milik owner sebagai client Hub.
+// Poll dengan ?since= yang sama dengan cursor poll sebelumnya memakai ulang
+// client yang sedang linger sehingga tidak menambah jumlah viewer. Pesan
+// setelah ?since= dikirim ulang dari replay buffer seperti pada /ws.
+func OpenPoll(h *Hub, r *http.Request, owner string) (*Poll, error) {
+	whatsappID := RequestWhatsappID(r)
+
+	if since, ok := requestSince(r); ok {
+		if p := h.resumePoll(pollKey{owner: owner, whatsappID: whatsappID, cursor: since}); p != nil {
+			return p, nil
+		}
+	}
+
+	t := &pollTransport{
+		remoteAddr: r.RemoteAddr,
+		ready:      make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	// Ping tidak dipakai, interval panjang hanya untuk ticker writePump
+	client := h.newClient(r, whatsappID, t, pollMaxTimeout())
+
+	// Tanpa ?since=, cursor dimulai dari seq terakhir agar poll berikutnya
+	// tidak mengulang pesan lama
+	since := client.since
+	if !client.resume {
+		since = h.currentSeq(r.Context(), whatsappID)
+	}
+
+	if err := h.registerClient(client); err != nil {
+		return nil, err
+	}
+
+	h.pumps.Add(1)
+	go client.writePump(h)
+
+	return &Poll{
+		hub:       h,
+		client:    client,
+		transport: t,
+		owner:     owner,
+		since:     since,
+		first:     true,
+	}, nil
+}
+
+// resumePoll mengambil client poll yang sedang linger untuk key, nil jika
+// tidak ada atau client sudah dilepas
+func (h *Hub) resumePoll(key pollKey) *Poll {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.polls[key]
+	if !ok {
+		return nil
+	}
+	delete(h.polls, key)
+	// Timer yang sudah berjalan sedang melepas client, buat client baru
+	if !p.linger.Stop() || p.client.closed {
+		return nil
+	}
+	p.since = key.cursor
+	p.first = false
+	return p
+}
+
+// First menentukan apakah poll ini membuka client baru, bukan lanjutan poll
+// sebelumnya, sehingga stream QR perlu dimulai. Stream yang sudah berjalan
+// tidak terpengaruh karena hanya satu replica yang bisa memegang lease-nya.
+func (p *Poll) First() bool {
+	return p.first
+}
+
+// Wait menunggu sampai ada pesan, timeout habis, atau ctx berakhir, lalu
+// mengembalikan pesan beserta cursor berikutnya. Client tetap terdaftar
+// selama poll.linger agar stream QR tidak berhenti di antara dua poll dan
+// bisa dipakai ulang oleh poll dengan cursor tersebut.
+func (p *Poll) Wait(ctx context.Context, timeout time.Duration) model.PollResponse {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var batch [][]byte
+wait:
+	for len(batch) == 0 {
+		select {
+		case <-p.transport.ready:
+			// Sinyal bisa tersisa dari pesan yang sudah diambil poll sebelumnya
+			batch = p.transport.take()
+		case <-p.transport.closed:
+			break wait
+		case <-timer.C:
+			break wait
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	batch = append(batch, p.transport.take()...)
+
+	response := model.PollResponse{Messages: make([]model.WSMessage, 0, len(batch)), Next: p.since}
+	for _, payload := range batch {
+		var message model.WSMessage
+		if err := json.Unmarshal(payload, &message); err != nil {
+			continue
+		}
+		response.Messages = append(response.Messages, message)
+		if message.Seq > response.Next {
+			response.Next = message.Seq
+		}
+	}
+
+	p.park(response.Next)
+	return response
+}
+
+// park menyimpan client untuk poll berikutnya dengan cursor next dan
+// melepasnya dari Hub jika poll tersebut tidak datang dalam poll.linger
+func (p *Poll) park(next int64) {
+	h := p.hub
+	key := pollKey{owner: p.owner, whatsappID: p.client.id, cursor: next}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if old, ok := h.polls[key]; ok && old != p && old.linger.Stop() {
+		go h.unregisterClient(old.client)
+	}
+	h.polls[key] = p
+	p.linger = time.AfterFunc(pollLinger(), func() {
+		h.mu.Lock()
+		if h.polls[key] == p {
+			delete(h.polls, key)
+		}
+		h.mu.Unlock()
+		h.unregisterClient(p.client)
+	})
+}
+
+// PollTimeout membaca ?timeout= sebagai durasi (30s) atau detik (30), dibatasi poll.max_timeout
+func PollTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return util.ConfigSeconds(util.Configuration.Poll.DefaultTimeout, defaultPollTimeout), nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, ErrInvalidPollTimeout
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout <= 0 {
+		return 0, ErrInvalidPollTimeout
+	}
+	return min(timeout, pollMaxTimeout()), nil
+}
+
+func pollMaxTimeout() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Poll.MaxTimeout, defaultPollMaxTimeout)
+}
+
+func pollLinger() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Poll.Linger, defaultPollLinger)
+}
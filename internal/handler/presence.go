@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"qrstreamer/internal/provider"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyViewersPrefix = "wsviewers:"
+
+	// viewerPresenceTTL adalah umur tanda viewer sebuah replica. Tanda diperbarui
+	// setiap sepertiga TTL sehingga replica yang mati berhenti dihitung setelah TTL.
+	viewerPresenceTTL = 30 * time.Second
+)
+
+// viewersKey mengembalikan sorted set replica yang memiliki viewer whatsappID.
+// Member adalah replicaID, score adalah waktu kedaluwarsa dalam milidetik.
+func viewersKey(whatsappID string) string {
+	return keyViewersPrefix + whatsappID
+}
+
+// announce menandai replica ini memiliki viewer whatsappID, false jika gagal
+func (h *Hub) announce(ctx context.Context, whatsappID string) bool {
+	key := viewersKey(whatsappID)
+	now := time.Now()
+	expiry := now.Add(viewerPresenceTTL).UnixMilli()
+
+	pipe := h.redis.TxPipeline()
+	// Buang tanda replica yang sudah tidak memperbarui diri
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiry), Member: h.replicaID})
+	pipe.PExpire(ctx, key, viewerPresenceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error announcing viewers of %s: %v", whatsappID, err)
+		return false
+	}
+	return true
+}
+
+// withdraw menghapus tanda viewer replica ini untuk whatsappID, false jika gagal
+func (h *Hub) withdraw(ctx context.Context, whatsappID string) bool {
+	if err := h.redis.ZRem(ctx, viewersKey(whatsappID), h.replicaID).Err(); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error withdrawing viewers of %s: %v", whatsappID, err)
+		return false
+	}
+	return true
+}
+
+// HasViewers menentukan apakah whatsappID masih memiliki viewer di replica
+// ini atau di replica lain. Error Redis dikembalikan agar caller tidak
+// menghentikan stream hanya karena Redis tidak bisa dibaca.
+func (h *Hub) HasViewers(ctx context.Context, whatsappID string) (bool, error) {
+	if h.ViewerCount(whatsappID) > 0 {
+		return true, nil
+	}
+
+	replicas, err := h.redis.ZRangeByScore(ctx, viewersKey(whatsappID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return false, err
+	}
+	// Tanda replica ini bisa tertinggal sampai syncSubscriptions menghapusnya
+	for _, replicaID := range replicas {
+		if replicaID != h.replicaID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"strings"
+	"time"
+)
+
+const keyWSChannelPrefix = "wsmsg:"
+
+// wsChannel mengembalikan nama channel Redis Pub/Sub untuk whatsappID
+func wsChannel(whatsappID string) string {
+	return keyWSChannelPrefix + whatsappID
+}
+
+// PublishMessage memberi nomor urut pada pesan, menyimpannya untuk replay,
+// lalu mengirimnya ke channel Redis milik whatsappID sehingga viewer di semua
+// replica menerimanya. Jika publish gagal, pesan tetap dikirim ke viewer lokal.
+func (h *Hub) PublishMessage(ctx context.Context, whatsappID string, data model.WSMessage) error {
+	data.Seq = h.nextSeq(ctx, whatsappID)
+	msgBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	h.storeReplay(ctx, whatsappID, data.Seq, msgBytes)
+
+	h.logger.Infofctx(provider.AppLog, ctx, "Publishing to channel %s: %s", wsChannel(whatsappID), msgBytes)
+
+	if err := h.redis.Publish(ctx, wsChannel(whatsappID), msgBytes).Err(); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error publishing to channel %s, emitting locally: %v", wsChannel(whatsappID), err)
+		h.EmitToClient(whatsappID, msgBytes)
+		return err
+	}
+
+	return nil
+}
+
+// notifySubscriptions meminta syncSubscriptions menyamakan channel Pub/Sub
+// dengan daftar whatsappID. Aman dipanggil sambil memegang h.mu.
+func (h *Hub) notifySubscriptions() {
+	select {
+	case h.resync <- struct{}{}:
+	default:
+	}
+}
+
+// syncSubscriptions men-subscribe channel whatsappID yang memiliki viewer lokal
+// dan channel kontrol stream yang dipegang replica ini, lalu meng-unsubscribe
+// sisanya, sekaligus menandai kehadiran viewer replica ini di Redis untuk
+// HasViewers. Panggilan Redis dilakukan di luar h.mu agar registrasi dan
+// pengiriman pesan tidak tertahan oleh Redis yang lambat.
+func (h *Hub) syncSubscriptions(ctx context.Context) {
+	subscribed := make(map[string]struct{})
+	present := make(map[string]struct{})
+
+	heartbeat := time.NewTicker(viewerPresenceTTL / 3)
+	defer heartbeat.Stop()
+
+	defer func() {
+		// Hapus tanda viewer agar replica lain tidak menunggu sampai TTL habis
+		withdrawCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+		defer cancel()
+		for whatsappID := range present {
+			h.withdraw(withdrawCtx, whatsappID)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			for whatsappID := range present {
+				h.announce(ctx, whatsappID)
+			}
+			continue
+		case <-h.resync:
+		}
+
+		var viewed, channels []string
+		h.mu.Lock()
+		for whatsappID := range h.clients {
+			viewed = append(viewed, whatsappID)
+			channels = append(channels, wsChannel(whatsappID))
+		}
+		for whatsappID := range h.controls {
+			channels = append(channels, controlChannel(whatsappID))
+		}
+		h.mu.Unlock()
+
+		wantedPresence := make(map[string]struct{}, len(viewed))
+		for _, whatsappID := range viewed {
+			wantedPresence[whatsappID] = struct{}{}
+			if _, ok := present[whatsappID]; !ok && h.announce(ctx, whatsappID) {
+				present[whatsappID] = struct{}{}
+			}
+		}
+		for whatsappID := range present {
+			if _, ok := wantedPresence[whatsappID]; !ok && h.withdraw(ctx, whatsappID) {
+				delete(present, whatsappID)
+			}
+		}
+
+		wanted := make(map[string]struct{}, len(channels))
+		for _, channel := range channels {
+			wanted[channel] = struct{}{}
+			if _, ok := subscribed[channel]; !ok && h.subscribe(ctx, channel) {
+				subscribed[channel] = struct{}{}
+			}
+		}
+		for channel := range subscribed {
+			if _, ok := wanted[channel]; !ok && h.unsubscribe(ctx, channel) {
+				delete(subscribed, channel)
+			}
+		}
+	}
+}
+
+// subscribe mulai mendengarkan channel, false jika gagal
+func (h *Hub) subscribe(ctx context.Context, channel string) bool {
+	if err := h.pubsub.Subscribe(ctx, channel); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error subscribing to channel %s: %v", channel, err)
+		return false
+	}
+	h.logger.Debugfctx(provider.AppLog, ctx, "Subscribed to channel %s", channel)
+	return true
+}
+
+// unsubscribe berhenti mendengarkan channel, false jika gagal
+func (h *Hub) unsubscribe(ctx context.Context, channel string) bool {
+	if err := h.pubsub.Unsubscribe(ctx, channel); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error unsubscribing from channel %s: %v", channel, err)
+		return false
+	}
+	h.logger.Debugfctx(provider.AppLog, ctx, "Unsubscribed from channel %s", channel)
+	return true
+}
+
+// listen meneruskan pesan dari Redis Pub/Sub ke viewer lokal dan perintah
+// kontrol ke handler WatchControl
+func (h *Hub) listen() {
+	for msg := range h.pubsub.Channel() {
+		if strings.HasPrefix(msg.Channel, keyControlChannelPrefix) {
+			h.dispatchControl(msg.Channel, msg.Payload)
+			continue
+		}
+		whatsappID := strings.TrimPrefix(msg.Channel, keyWSChannelPrefix)
+		payload := []byte(msg.Payload)
+		h.replay.add(whatsappID, payloadSeq(payload), payload)
+		h.EmitToClient(whatsappID, payload)
+	}
+	h.logger.Infof(provider.AppLog, "Pub/Sub listener stopped")
+}
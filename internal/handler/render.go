@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"strings"
+)
+
+// renderFormat adalah bitmask format gambar QR yang diminta client
+type renderFormat uint8
+
+const (
+	renderPNG renderFormat = 1 << iota
+	renderSVG
+)
+
+// parseRenderFormats membaca query parameter render, contoh: ?render=png,svg
+func parseRenderFormats(value string) renderFormat {
+	var formats renderFormat
+	for _, f := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "png":
+			formats |= renderPNG
+		case "svg":
+			formats |= renderSVG
+		}
+	}
+	return formats
+}
+
+// wantedFormats menggabungkan format yang diminta seluruh viewer whatsappID
+func (h *Hub) wantedFormats(whatsappID string) renderFormat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var formats renderFormat
+	for client := range h.clients[whatsappID] {
+		formats |= client.render
+	}
+	return formats
+}
+
+// renderQRVariants merender pesan qr_code sekali untuk setiap kombinasi format
+// yang diminta viewer. Mengembalikan nil jika pesan bukan qr_code atau tidak
+// ada viewer yang meminta gambar.
+func (h *Hub) renderQRVariants(whatsappID string, message []byte) map[renderFormat][]byte {
+	return h.renderQRVariantsFor(whatsappID, message, h.wantedFormats(whatsappID))
+}
+
+// renderQRVariantsFor merender pesan qr_code untuk format wanted saja. Tidak
+// memakai h.mu sehingga aman dipanggil saat lock dipegang.
+func (h *Hub) renderQRVariantsFor(whatsappID string, message []byte, wanted renderFormat) map[renderFormat][]byte {
+	if wanted == 0 {
+		return nil
+	}
+
+	var msg model.WSMessage
+	if err := json.Unmarshal(message, &msg); err != nil || msg.Type != "qr_code" || msg.Data == "" {
+		return nil
+	}
+
+	opt := util.QRImageOptionsFromConfig()
+
+	var pngURI, svgURI string
+	if wanted&renderPNG != 0 {
+		img, err := util.RenderQRPNG(msg.Data, opt)
+		if err != nil {
+			h.logger.Errorf(provider.AppLog, "Error rendering QR PNG for %s: %v", whatsappID, err)
+		} else {
+			pngURI = util.DataURI("image/png", img)
+		}
+	}
+	if wanted&renderSVG != 0 {
+		img, err := util.RenderQRSVG(msg.Data, opt)
+		if err != nil {
+			h.logger.Errorf(provider.AppLog, "Error rendering QR SVG for %s: %v", whatsappID, err)
+		} else {
+			svgURI = util.DataURI("image/svg+xml", img)
+		}
+	}
+
+	variants := make(map[renderFormat][]byte)
+	for _, formats := range []renderFormat{renderPNG, renderSVG, renderPNG | renderSVG} {
+		if formats&wanted != formats {
+			continue
+		}
+
+		variant := msg
+		if formats&renderPNG != 0 {
+			variant.PNG = pngURI
+		}
+		if formats&renderSVG != 0 {
+			variant.SVG = svgURI
+		}
+
+		msgBytes, err := json.Marshal(variant)
+		if err != nil {
+			continue
+		}
+		variants[formats] = msgBytes
+	}
+	return variants
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keySeqPrefix    = "wsseq:"
+	keyReplayPrefix = "wsreplay:"
+
+	defaultReplayBufferSize = 100
+	defaultReplayTTL        = 10 * time.Minute
+)
+
+// replayEntry adalah satu pesan bernomor urut yang disimpan untuk replay
+type replayEntry struct {
+	seq     int64
+	payload []byte
+	at      time.Time
+}
+
+// replayBuffer menyimpan pesan terakhir setiap whatsappID dalam ring buffer
+// berukuran tetap, diurutkan berdasarkan seq
+type replayBuffer struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	rings map[string][]replayEntry
+}
+
+func newReplayBuffer() *replayBuffer {
+	size := util.Configuration.Replay.BufferSize
+	if size <= 0 {
+		size = defaultReplayBufferSize
+	}
+	ttl := util.ConfigSeconds(util.Configuration.Replay.TTL, defaultReplayTTL)
+
+	return &replayBuffer{
+		size:  size,
+		ttl:   ttl,
+		rings: make(map[string][]replayEntry),
+	}
+}
+
+// add menyimpan payload. Pesan dengan seq yang sudah tersimpan diabaikan
+// karena replica penerbit juga menerima pesannya sendiri lewat Pub/Sub.
+func (b *replayBuffer) add(whatsappID string, seq int64, payload []byte) {
+	if seq <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ring := b.rings[whatsappID]
+	if n := len(ring); n > 0 && seq <= ring[n-1].seq {
+		return
+	}
+	ring = append(ring, replayEntry{seq: seq, payload: payload, at: time.Now()})
+	if len(ring) > b.size {
+		ring = append(ring[:0:0], ring[len(ring)-b.size:]...)
+	}
+	b.rings[whatsappID] = ring
+}
+
+// since mengembalikan pesan dengan seq lebih besar dari seq
+func (b *replayBuffer) since(whatsappID string, seq int64) []replayEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []replayEntry
+	for _, entry := range b.rings[whatsappID] {
+		if entry.seq > seq {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// prune menghapus buffer whatsappID yang tidak menerima pesan selama ttl
+func (b *replayBuffer) prune(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for whatsappID, ring := range b.rings {
+		if n := len(ring); n == 0 || now.Sub(ring[n-1].at) > b.ttl {
+			delete(b.rings, whatsappID)
+		}
+	}
+}
+
+// nextSeq mengambil nomor urut berikutnya untuk whatsappID dari Redis sehingga
+// nomor urut tetap monoton di semua replica. Counter kedaluwarsa bersama
+// replay agar akun yang tidak aktif tidak meninggalkan key. Counter baru
+// dimulai dari waktu sekarang dalam milidetik, bukan 1, sehingga tetap lebih
+// besar dari seq sebelum kedaluwarsa yang masih dipegang viewer. Mengembalikan 0 jika gagal.
+func (h *Hub) nextSeq(ctx context.Context, whatsappID string) int64 {
+	key := keySeqPrefix + whatsappID
+
+	pipe := h.redis.TxPipeline()
+	pipe.SetNX(ctx, key, time.Now().UnixMilli(), 0)
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, h.replay.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error allocating sequence for %s: %v", whatsappID, err)
+		return 0
+	}
+	return incr.Val()
+}
+
+// currentSeq mengembalikan seq terakhir yang sudah dipakai whatsappID, 0 jika belum ada
+func (h *Hub) currentSeq(ctx context.Context, whatsappID string) int64 {
+	seq, err := h.redis.Get(ctx, keySeqPrefix+whatsappID).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			h.logger.Errorfctx(provider.AppLog, ctx, false, "Error reading sequence for %s: %v", whatsappID, err)
+		}
+		return 0
+	}
+	return seq
+}
+
+// storeReplay menyimpan pesan ke buffer lokal dan, jika replay.redis_stream
+// aktif, ke Redis Stream milik whatsappID
+func (h *Hub) storeReplay(ctx context.Context, whatsappID string, seq int64, payload []byte) {
+	if seq <= 0 {
+		return
+	}
+	h.replay.add(whatsappID, seq, payload)
+
+	if !util.Configuration.Replay.RedisStream {
+		return
+	}
+
+	key := keyReplayPrefix + whatsappID
+	pipe := h.redis.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: int64(h.replay.size),
+		Approx: true,
+		Values: map[string]interface{}{"seq": seq, "payload": payload},
+	})
+	pipe.Expire(ctx, key, h.replay.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error storing replay for %s: %v", whatsappID, err)
+	}
+}
+
+// loadReplay membaca pesan dengan seq lebih besar dari since. Redis Stream
+// dipakai jika aktif, buffer lokal dipakai jika Redis gagal atau tidak aktif.
+func (h *Hub) loadReplay(ctx context.Context, whatsappID string, since int64) []replayEntry {
+	if !util.Configuration.Replay.RedisStream {
+		return h.replay.since(whatsappID, since)
+	}
+
+	messages, err := h.redis.XRange(ctx, keyReplayPrefix+whatsappID, "-", "+").Result()
+	if err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error loading replay for %s, using local buffer: %v", whatsappID, err)
+		return h.replay.since(whatsappID, since)
+	}
+
+	var entries []replayEntry
+	for _, message := range messages {
+		seqValue, _ := message.Values["seq"].(string)
+		payload, _ := message.Values["payload"].(string)
+		seq, err := strconv.ParseInt(seqValue, 10, 64)
+		if err != nil || seq <= since {
+			continue
+		}
+		entries = append(entries, replayEntry{seq: seq, payload: []byte(payload)})
+	}
+	return entries
+}
+
+// loadLatestQR membaca QR terakhir whatsappID beserta pesan setelahnya dari
+// replay buffer, nil jika belum ada QR yang tersimpan. Dipakai agar viewer yang
+// bergabung saat stream sudah berjalan langsung menerima QR bernomor urut.
+func (h *Hub) loadLatestQR(ctx context.Context, whatsappID string) []replayEntry {
+	entries := h.loadReplay(ctx, whatsappID, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if isQRPayload(entries[i].payload) {
+			return entries[i:]
+		}
+	}
+	return nil
+}
+
+// renderReplay mengganti payload qr_code di entries dengan gambar QR sesuai
+// format yang diminta client. Dipanggil di luar h.mu karena rendering mahal.
+func (h *Hub) renderReplay(whatsappID string, render renderFormat, entries []replayEntry) []replayEntry {
+	if render == 0 || len(entries) == 0 {
+		return entries
+	}
+	rendered := make([]replayEntry, len(entries))
+	for i, entry := range entries {
+		if variant, ok := h.renderQRVariantsFor(whatsappID, entry.payload, render)[render]; ok {
+			entry.payload = variant
+		}
+		rendered[i] = entry
+	}
+	return rendered
+}
+
+// lockForReplay mengambil h.mu lalu melengkapi entries dengan pesan yang masuk
+// ke buffer lokal setelah entries dibaca. Jika pesan tersebut perlu dirender,
+// lock dilepas selama rendering lalu diperiksa ulang, sehingga h.mu tidak
+// pernah dipegang saat merender. entries harus sudah dirender lewat
+// renderReplay. Mengembalikan entries lengkap dengan h.mu masih dipegang.
+func (h *Hub) lockForReplay(client *Client, whatsappID string, since int64, entries []replayEntry) []replayEntry {
+	for {
+		last := since
+		if n := len(entries); n > 0 {
+			last = entries[n-1].seq
+		}
+
+		h.mu.Lock()
+		missed := h.replay.since(whatsappID, last)
+		if client.render == 0 || !slices.ContainsFunc(missed, func(entry replayEntry) bool { return isQRPayload(entry.payload) }) {
+			return append(entries, missed...)
+		}
+		h.mu.Unlock()
+
+		entries = append(entries, h.renderReplay(whatsappID, client.render, missed)...)
+	}
+}
+
+// replayTo mengantrekan pesan replay ke client sebelum pesan live. entries
+// harus berasal dari lockForReplay. Caller harus memegang h.mu.
+func (h *Hub) replayTo(client *Client, whatsappID string, since int64, entries []replayEntry) {
+	// Beri tahu client jika sebagian pesan sudah keluar dari buffer
+	if len(entries) > 0 && entries[0].seq > since+1 {
+		if msgBytes, err := json.Marshal(model.WSMessage{
+			MsgStatus:  false,
+			Type:       "replay_truncated",
+			WhatsappId: whatsappID,
+			Data:       "Some messages are no longer available, oldest replayed seq is " + strconv.FormatInt(entries[0].seq, 10),
+			Timestamp:  time.Now(),
+		}); err == nil {
+			h.enqueue(client, msgBytes)
+		}
+	}
+
+	for _, entry := range entries {
+		if !h.enqueue(client, entry.payload) {
+			return
+		}
+		client.lastSeq[whatsappID] = entry.seq
+	}
+	if len(entries) > 0 {
+		h.logger.Infofctx(provider.AppLog, client.ctx, "Replayed %d message(s) since seq %d for ID: %s, Address: %s", len(entries), since, whatsappID, client.transport.RemoteAddr())
+	}
+}
+
+// payloadSeq membaca seq dari payload WSMessage, 0 jika tidak ada
+func payloadSeq(payload []byte) int64 {
+	var message struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return 0
+	}
+	return message.Seq
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLockForReplayRendersMissedQR(t *testing.T) {
+	h := newTestHub(t)
+	client := &Client{render: renderPNG}
+
+	// QR masuk ke buffer lokal setelah entries dibaca caller
+	h.replay.add("wa-1", 5, []byte(`{"msg_status":true,"type":"qr_code","whatsapp_id":"wa-1","data":"2@abc","seq":5}`))
+
+	entries := h.lockForReplay(client, "wa-1", 4, nil)
+	if h.mu.TryLock() {
+		h.mu.Unlock()
+		t.Fatal("lockForReplay must return with h.mu held")
+	}
+	h.mu.Unlock()
+
+	if len(entries) != 1 || entries[0].seq != 5 {
+		t.Fatalf("entries = %+v, want seq 5 only", entries)
+	}
+	if !strings.Contains(string(entries[0].payload), "data:image/png") {
+		t.Fatalf("missed QR was not rendered: %s", entries[0].payload)
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Shutdown mengirim server_shutdown dan close frame 1001 ke semua client, lalu
+// menunggu readPump dan writePump selesai atau ctx berakhir. Client baru yang
+// mendaftar setelah Shutdown dipanggil langsung ditolak.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.shuttingDown = true
+
+	// Client yang sudah unsubscribe dari semua whatsappID tidak ada di h.clients,
+	// sehingga yang ditutup adalah semua client terdaftar
+	clients := make([]*Client, 0, len(h.conns))
+	for client := range h.conns {
+		clients = append(clients, client)
+	}
+	h.logger.Infofctx(provider.AppLog, ctx, "Shutting down Hub, closing %d client(s)", len(clients))
+
+	for _, client := range clients {
+		msgBytes, err := json.Marshal(model.WSMessage{
+			MsgStatus:  false,
+			Type:       "server_shutdown",
+			WhatsappId: client.id,
+			Data:       "Server is shutting down, please reconnect",
+			Timestamp:  time.Now(),
+		})
+		if err == nil {
+			h.enqueue(client, msgBytes)
+		}
+		h.closeClient(client, websocket.CloseGoingAway, ErrHubClosed.Error())
+	}
+	h.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Hub shutdown did not drain in time: %v", ctx.Err())
+		return ctx.Err()
+	}
+
+	if err := h.pubsub.Close(); err != nil {
+		h.logger.Errorfctx(provider.AppLog, ctx, false, "Error closing Pub/Sub: %v", err)
+	}
+	return nil
+}
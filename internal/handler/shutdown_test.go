@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownClosesUnsubscribedClient(t *testing.T) {
+	h := newTestHub(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	tr := &fakeTransport{}
+	client := h.newClient(httptest.NewRequest("GET", "/ws?wa_id=wa-1", nil), "wa-1", tr, time.Minute)
+	if err := h.registerClient(client); err != nil {
+		t.Fatalf("registerClient: %v", err)
+	}
+	h.pumps.Add(1)
+	go client.writePump(h)
+
+	// Client tetap terhubung tetapi tidak lagi ada di viewer set mana pun
+	h.Unsubscribe(client, "wa-1")
+
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 2*time.Second)
+	defer stop()
+	if err := h.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	h.mu.Lock()
+	closed := client.closed
+	h.mu.Unlock()
+	if !closed {
+		t.Fatal("unsubscribed client was not closed")
+	}
+	if code := tr.closeCode(); code != websocket.CloseGoingAway {
+		t.Fatalf("close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+	if !tr.received("server_shutdown") {
+		t.Fatal("server_shutdown was not sent")
+	}
+}
+
+// fakeTransport mencatat pesan dan close frame yang dikirim writePump
+type fakeTransport struct {
+	mu       sync.Mutex
+	messages []string
+	code     int
+	closed   bool
+}
+
+func (t *fakeTransport) Name() string       { return "fake" }
+func (t *fakeTransport) RemoteAddr() string { return "192.0.2.1:1234" }
+func (t *fakeTransport) WritePing() error   { return nil }
+
+func (t *fakeTransport) WriteMessage(payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, string(payload))
+	return nil
+}
+
+func (t *fakeTransport) WriteClose(code int, text string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.code = code
+	return nil
+}
+
+func (t *fakeTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+func (t *fakeTransport) closeCode() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.code
+}
+
+func (t *fakeTransport) received(msgType string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, msg := range t.messages {
+		if payloadType(msg) == msgType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"qrstreamer/internal/provider"
+	"qrstreamer/util"
+	"time"
+)
+
+const (
+	defaultSSEHeartbeat = 15 * time.Second
+
+	// sseRetry adalah jeda reconnect yang disarankan ke EventSource
+	sseRetry = 3 * time.Second
+)
+
+// sseHeartbeat mengembalikan jeda komentar heartbeat dari sse.heartbeat
+func sseHeartbeat() time.Duration {
+	return util.ConfigSeconds(util.Configuration.SSE.Heartbeat, defaultSSEHeartbeat)
+}
+
+// sseTransport mengirim pesan sebagai event Server-Sent Events. Field id
+// berisi seq pesan sehingga browser mengirimnya kembali lewat Last-Event-ID.
+// Pesan dikirim tanpa field event agar diterima EventSource.onmessage; tipe
+// pesan dibaca dari field type di data. Hanya penutupan koneksi yang dikirim
+// sebagai event bernama "close".
+type sseTransport struct {
+	w          http.ResponseWriter
+	rc         *http.ResponseController
+	remoteAddr string
+}
+
+func (t *sseTransport) Name() string {
+	return "sse"
+}
+
+func (t *sseTransport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+func (t *sseTransport) WriteMessage(payload []byte) error {
+	var message struct {
+		Seq int64 `json:"seq"`
+	}
+	json.Unmarshal(payload, &message)
+
+	var event []byte
+	if message.Seq > 0 {
+		event = fmt.Appendf(event, "id: %d\n", message.Seq)
+	}
+	event = fmt.Appendf(event, "data: %s\n\n", payload)
+	return t.write(event)
+}
+
+func (t *sseTransport) WritePing() error {
+	return t.write([]byte(": heartbeat\n\n"))
+}
+
+// WriteClose mengirim event close karena SSE tidak memiliki close frame.
+// Client mendengarkannya lewat addEventListener("close", ...).
+func (t *sseTransport) WriteClose(code int, text string) error {
+	data, err := json.Marshal(map[string]interface{}{"code": code, "reason": text})
+	if err != nil {
+		return err
+	}
+	return t.write(fmt.Appendf(nil, "event: close\ndata: %s\n\n", data))
+}
+
+// Close tidak melakukan apa pun, koneksi ditutup saat handler /sse selesai
+func (t *sseTransport) Close() error {
+	return nil
+}
+
+func (t *sseTransport) write(event []byte) error {
+	if err := t.rc.SetWriteDeadline(time.Now().Add(wsWriteWait())); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := t.w.Write(event); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+// ServeSSE mendaftarkan request sebagai client SSE di Hub. Channel yang
+// dikembalikan ditutup saat koneksi selesai; jika tidak nil, handler harus
+// menunggunya sebelum kembali karena ResponseWriter masih dipakai writePump.
+func ServeSSE(h *Hub, w http.ResponseWriter, r *http.Request) (<-chan struct{}, error) {
+	whatsappID := RequestWhatsappID(r)
+	if err := h.checkViewerLimit(w, whatsappID); err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	// Matikan buffering proxy agar event langsung diteruskan
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+		return nil, err
+	}
+	if err := rc.Flush(); err != nil {
+		h.logger.Errorfctx(provider.AppLog, r.Context(), false, "SSE flush not supported: %v", err)
+		return nil, err
+	}
+
+	client := h.newClient(r, whatsappID, &sseTransport{w: w, rc: rc, remoteAddr: r.RemoteAddr}, sseHeartbeat())
+	err := h.registerClient(client)
+
+	// Client yang ditolak tetap menerima event error dan close dari writePump
+	done := make(chan struct{})
+	h.pumps.Add(2)
+	go func() {
+		client.writePump(h)
+		close(done)
+	}()
+
+	// SSE tidak memiliki readPump, putusnya koneksi dideteksi dari context request
+	go func() {
+		defer h.pumps.Done()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+		h.unregisterClient(client)
+	}()
+
+	return done, err
+}
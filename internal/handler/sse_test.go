@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSEMessageHasNoEventName(t *testing.T) {
+	rec := httptest.NewRecorder()
+	tr := &sseTransport{w: rec, rc: http.NewResponseController(rec)}
+
+	if err := tr.WriteMessage([]byte(`{"seq":7,"type":"qr_code","data":"qr"}`)); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	// Tanpa field event agar EventSource.onmessage menerima pesan
+	want := "id: 7\ndata: {\"seq\":7,\"type\":\"qr_code\",\"data\":\"qr\"}\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("frame = %q, want %q", got, want)
+	}
+}
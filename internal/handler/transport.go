@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// transport mengirim pesan Hub ke satu client. Semua method hanya dipanggil
+// dari writePump, kecuali RemoteAddr dan Name.
+type transport interface {
+	// Name mengembalikan nama transport untuk API dan log, mis. "websocket"
+	Name() string
+	RemoteAddr() string
+	// WriteMessage mengirim satu payload WSMessage
+	WriteMessage(payload []byte) error
+	// WritePing menjaga koneksi tetap hidup, dipanggil setiap pingInterval
+	WritePing() error
+	// WriteClose memberi tahu client alasan koneksi ditutup
+	WriteClose(code int, text string) error
+	Close() error
+}
+
+// wsTransport mengirim pesan sebagai text frame WebSocket
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *wsTransport) Name() string {
+	return "websocket"
+}
+
+func (t *wsTransport) RemoteAddr() string {
+	return t.conn.RemoteAddr().String()
+}
+
+func (t *wsTransport) WriteMessage(payload []byte) error {
+	t.conn.SetWriteDeadline(time.Now().Add(wsWriteWait()))
+	return t.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (t *wsTransport) WritePing() error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait()))
+}
+
+func (t *wsTransport) WriteClose(code int, text string) error {
+	return t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait()))
+}
+
+func (t *wsTransport) Close() error {
+	return t.conn.Close()
+}
+
+// newClient membuat client untuk whatsappID dengan transport t. Jika request
+// membawa ?since=<seq> atau header Last-Event-ID, pesan setelah seq tersebut
+// dimuat untuk dikirim ulang saat registrasi. Tanpa itu, QR terakhir yang
+// tersimpan dimuat agar client tidak menunggu rotasi QR berikutnya.
+func (h *Hub) newClient(r *http.Request, whatsappID string, t transport, pingInterval time.Duration) *Client {
+	client := &Client{
+		// Context request dibatalkan saat handler selesai, sementara koneksi
+		// dan command client tetap berjalan setelahnya
+		ctx:       context.WithoutCancel(r.Context()),
+		id:        whatsappID,
+		transport: t,
+		send:      make(chan []byte, sendBuffer()),
+
+		connectedAt:  time.Now(),
+		render:       parseRenderFormats(r.URL.Query().Get("render")),
+		pingInterval: pingInterval,
+
+		registered: make(chan error, 1),
+		subs:       make(map[string]struct{}),
+		lastSeq:    make(map[string]int64),
+	}
+
+	if seq, ok := requestSince(r); ok {
+		client.resume = true
+		client.since = seq
+		client.replayFrom = h.loadReplay(r.Context(), whatsappID, seq)
+	} else if entries := h.loadLatestQR(r.Context(), whatsappID); len(entries) > 0 {
+		client.since = entries[0].seq - 1
+		client.replayFrom = entries
+	}
+	// Gambar QR dirender di sini agar Run tidak merender sambil memegang h.mu
+	client.replayFrom = h.renderReplay(whatsappID, client.render, client.replayFrom)
+	return client
+}
+
+// requestSince membaca seq terakhir yang diterima client dari ?since= atau header Last-Event-ID
+func requestSince(r *http.Request) (int64, bool) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+	if since == "" {
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false
+	}
+	return seq, true
+}
+
+// registerClient mendaftarkan client lewat Hub.Run dan menunggu hasilnya.
+// Client yang ditolak, termasuk saat Run sudah berhenti, tetap harus dijalankan
+// pump-nya agar pesan penolakan dan close frame terkirim lalu koneksi ditutup.
+func (h *Hub) registerClient(client *Client) error {
+	select {
+	case h.register <- client:
+	case <-h.done:
+		h.mu.Lock()
+		client.closed = true
+		h.mu.Unlock()
+
+		h.rejectClient(client, ErrHubClosed.Error(), websocket.CloseGoingAway, ErrHubClosed.Error())
+		return ErrHubClosed
+	}
+	return <-client.registered
+}
+
+// writePump mengirim isi antrean client lewat transport-nya. Saat antrean
+// ditutup, close reason dikirim jika ada lalu koneksi ditutup.
+func (c *Client) writePump(h *Hub) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.transport.Close()
+		h.pumps.Done()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				if c.closeCode != 0 {
+					c.transport.WriteClose(c.closeCode, c.closeText)
+				}
+				return
+			}
+
+			if err := c.transport.WriteMessage(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.transport.WritePing(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// unregisterClient menghapus client dari Hub. Setelah Run berhenti, client
+// dihapus langsung tanpa lewat channel unregister.
+func (h *Hub) unregisterClient(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+		h.mu.Lock()
+		h.removeClient(client)
+		h.mu.Unlock()
+	}
+}
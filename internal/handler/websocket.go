@@ -3,35 +3,124 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"qrstreamer/internal/provider"
 	"qrstreamer/model"
+	"qrstreamer/util"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrViewerLimit dikembalikan ServeWS saat whatsappID sudah mencapai batas viewer
+	ErrViewerLimit = errors.New("viewer limit reached")
+	// ErrHubClosed dikembalikan ServeWS saat Hub sedang atau sudah dimatikan
+	ErrHubClosed = errors.New("server shutting down")
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // untuk demo, production sebaiknya dibatasi
-	},
+	CheckOrigin: checkOrigin,
+	// Client boleh mengirim token lewat Sec-WebSocket-Protocol: bearer, <jwt>
+	Subprotocols: []string{"bearer"},
+}
+
+// checkOrigin hanya menerima Origin yang ada di websocket.allowed_origins.
+// Request tanpa header Origin (client non-browser) diterima.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range util.Configuration.Websocket.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
 }
 
 type Client struct {
-	ctx  context.Context
-	id   string
-	conn *websocket.Conn
-	send chan []byte
+	ctx       context.Context
+	id        string
+	transport transport
+	send      chan []byte
+
+	connectedAt time.Time
+	// pingInterval adalah jeda ping atau heartbeat dari writePump
+	pingInterval time.Duration
+
+	// render adalah format gambar QR yang diminta client lewat ?render=
+	render renderFormat
+
+	// registered menerima hasil registrasi dari Hub.Run, nil jika diterima
+	registered chan error
+
+	// closeCode dan closeText dikirim sebagai close frame saat send ditutup
+	closeCode int
+	closeText string
+
+	// subs adalah semua whatsappID yang diikuti client, termasuk id. Dijaga oleh Hub.mu.
+	subs map[string]struct{}
+	// closed menandai send sudah ditutup. Dijaga oleh Hub.mu.
+	closed bool
+
+	// dropped adalah jumlah pesan yang dibuang karena antrean kirim penuh
+	dropped atomic.Uint64
+
+	// lastSeq adalah seq terakhir yang sudah diantrekan per whatsappID. Dijaga oleh Hub.mu.
+	lastSeq map[string]int64
+	// resume diisi newClient jika client terhubung dengan ?since=. since dan
+	// replayFrom adalah pesan yang dikirim ulang saat registrasi, yaitu pesan
+	// setelah ?since= atau QR terakhir untuk client baru.
+	resume     bool
+	since      int64
+	replayFrom []replayEntry
 }
 
 type Hub struct {
 	logger     provider.ILogger
-	clients    map[string]*Client // map[whatsappID]*Client
-	broadcast  chan []byte
+	redis      *redis.Client
+	pubsub     *redis.PubSub
+	clients    map[string]map[*Client]struct{} // map[whatsappID]set of viewers
+	conns      map[*Client]struct{}            // semua client terdaftar, termasuk yang tidak mengikuti whatsappID mana pun
+	gone       map[string]chan struct{}        // ditutup saat viewer terakhir whatsappID keluar
+	maxViewers int
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.Mutex
+
+	// commands adalah handler command WebSocket berdasarkan tipe command
+	commands map[string]CommandHandler
+
+	// done ditutup saat Run berhenti
+	done chan struct{}
+	// shuttingDown menolak client baru setelah Shutdown dipanggil. Dijaga oleh mu.
+	shuttingDown bool
+	// pumps menunggu readPump dan writePump semua client selesai
+	pumps sync.WaitGroup
+
+	// replay menyimpan pesan terakhir per whatsappID untuk client yang tersambung ulang
+	replay *replayBuffer
+
+	// replicaID membedakan replica ini saat menandai kehadiran viewer di Redis
+	replicaID string
+	// resync memberi tahu syncSubscriptions bahwa daftar whatsappID di clients atau controls berubah
+	resync chan struct{}
+	// controls adalah handler channel kontrol per whatsappID. Dijaga oleh mu.
+	controls map[string]*controlWatch
+
+	// polls adalah client poll yang sedang linger, dipakai ulang oleh poll
+	// berikutnya dengan cursor yang sama. Dijaga oleh mu.
+	polls map[pollKey]*Poll
 }
 
 func (h *Hub) EmitMessageToClient(ctx context.Context, whatsappID string, data model.WSMessage) error {
@@ -49,24 +138,40 @@ func (h *Hub) EmitMessageToClient(ctx context.Context, whatsappID string, data m
 	return nil
 }
 
-// EmitToAll mengirim pesan ke semua client yang terhubung
-func (h *Hub) EmitToAll(message []byte) {
-	h.broadcast <- message
+// EmitToClients mengirim pesan ke daftar client, mis. hasil filter GetClients
+func (h *Hub) EmitToClients(clients []*Client, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range clients {
+		h.enqueue(client, message)
+	}
 }
 
 // EmitToClient mengirim pesan ke client tertentu berdasarkan ID
 func (h *Hub) EmitToClient(whatsappID string, message []byte) {
+	// Render gambar QR di luar lock, hanya untuk format yang diminta viewer
+	variants := h.renderQRVariants(whatsappID, message)
+	seq := payloadSeq(message)
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if client, exists := h.clients[whatsappID]; exists {
-		select {
-		case client.send <- message:
-		default:
-			// Client buffer penuh, disconnect client
-			delete(h.clients, whatsappID)
-			close(client.send)
+	for client := range h.clients[whatsappID] {
+		// Lewati pesan yang sudah diterima client lewat replay
+		if seq > 0 {
+			if seq <= client.lastSeq[whatsappID] {
+				continue
+			}
+			client.lastSeq[whatsappID] = seq
 		}
+
+		payload := message
+		if variant, ok := variants[client.render]; ok {
+			payload = variant
+		}
+
+		h.enqueue(client, payload)
 	}
 }
 
@@ -75,33 +180,186 @@ func (h *Hub) GetClients() []*Client {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	clients := make([]*Client, 0, len(h.clients))
-	for _, client := range h.clients {
+	clients := make([]*Client, 0, len(h.conns))
+	for client := range h.conns {
 		clients = append(clients, client)
 	}
 	return clients
 }
 
-// GetClientByID mengembalikan client berdasarkan ID
-func (h *Hub) GetClientByID(whatsappID string) (*Client, bool) {
+// Info mengembalikan ringkasan client untuk API
+func (c *Client) Info() model.ClientInfo {
+	return model.ClientInfo{
+		WhatsappId:  c.id,
+		Transport:   c.transport.Name(),
+		RemoteAddr:  c.transport.RemoteAddr(),
+		ConnectedAt: c.connectedAt,
+		Dropped:     c.dropped.Load(),
+	}
+}
+
+// ID mengembalikan whatsappID yang diminta client saat terhubung
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Context mengembalikan context request WebSocket client
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+// ViewerCount mengembalikan jumlah viewer yang terhubung untuk whatsappID
+func (h *Hub) ViewerCount(whatsappID string) int {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	client, exists := h.clients[whatsappID]
-	return client, exists
+	return len(h.clients[whatsappID])
 }
 
-// Close client connection by client ID
+// ViewersGone mengembalikan channel yang ditutup saat viewer lokal terakhir whatsappID keluar.
+// Jika saat ini tidak ada viewer, channel yang dikembalikan sudah tertutup.
+// Gunakan HasViewers untuk memeriksa viewer di replica lain.
+func (h *Hub) ViewersGone(whatsappID string) <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients[whatsappID]) == 0 {
+		gone := make(chan struct{})
+		close(gone)
+		return gone
+	}
+
+	gone, ok := h.gone[whatsappID]
+	if !ok {
+		gone = make(chan struct{})
+		h.gone[whatsappID] = gone
+	}
+	return gone
+}
+
+// Close all viewer connections by whatsappID
 func (h *Hub) CloseClientConnection(whatsappID string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if client, exists := h.clients[whatsappID]; exists {
+	for client := range h.clients[whatsappID] {
+		h.closeClient(client, websocket.CloseNormalClosure, "closed by server")
+	}
+}
+
+// Subscribe menambahkan client sebagai viewer whatsappID lalu mengirim QR
+// terakhir yang tersimpan. Otorisasi dilakukan oleh caller.
+func (h *Hub) Subscribe(client *Client, whatsappID string) error {
+	// QR terakhir dimuat dan dirender sebelum h.mu diambil
+	entries := h.loadLatestQR(client.ctx, whatsappID)
+	var since int64
+	if len(entries) > 0 {
+		since = entries[0].seq - 1
+		entries = h.lockForReplay(client, whatsappID, since, h.renderReplay(whatsappID, client.render, entries))
+	} else {
+		h.mu.Lock()
+	}
+	defer h.mu.Unlock()
+
+	if client.closed {
+		return net.ErrClosed
+	}
+	if _, ok := client.subs[whatsappID]; ok {
+		return nil
+	}
+	if err := h.addViewer(client, whatsappID); err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		h.replayTo(client, whatsappID, since, entries)
+	}
+	return nil
+}
+
+// Unsubscribe menghapus client dari viewer whatsappID tanpa menutup koneksinya
+func (h *Hub) Unsubscribe(client *Client, whatsappID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeViewer(client, whatsappID)
+}
+
+// IsSubscribed menentukan apakah client sedang mengikuti whatsappID
+func (h *Hub) IsSubscribed(client *Client, whatsappID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := client.subs[whatsappID]
+	return ok
+}
+
+// addViewer mendaftarkan client ke viewer whatsappID dengan memperhatikan batas viewer.
+// Caller harus memegang h.mu.
+func (h *Hub) addViewer(client *Client, whatsappID string) error {
+	viewers := h.clients[whatsappID]
+	if h.maxViewers > 0 && len(viewers) >= h.maxViewers {
+		return ErrViewerLimit
+	}
+	if viewers == nil {
+		viewers = make(map[*Client]struct{})
+		h.clients[whatsappID] = viewers
+		h.notifySubscriptions()
+	}
+	viewers[client] = struct{}{}
+	client.subs[whatsappID] = struct{}{}
+	h.logger.Infofctx(provider.AppLog, client.ctx, "Client subscribed to ID: %s, Address: %s, Viewers: %d", whatsappID, client.transport.RemoteAddr(), len(viewers))
+	return nil
+}
+
+// removeViewer menghapus client dari viewer whatsappID. Caller harus memegang h.mu.
+func (h *Hub) removeViewer(client *Client, whatsappID string) {
+	viewers, ok := h.clients[whatsappID]
+	if !ok {
+		return
+	}
+	if _, ok := viewers[client]; !ok {
+		return
+	}
+
+	delete(viewers, client)
+	delete(client.subs, whatsappID)
+	if len(viewers) == 0 {
 		delete(h.clients, whatsappID)
-		close(client.send)
-		client.conn.Close()
-		h.logger.Infofctx(provider.AppLog, client.ctx, "Client disconnected with ID: %s, Address: %s", client.id, client.conn.RemoteAddr())
+		h.notifySubscriptions()
+		if gone, ok := h.gone[whatsappID]; ok {
+			close(gone)
+			delete(h.gone, whatsappID)
+		}
+	}
+	h.logger.Infofctx(provider.AppLog, client.ctx, "Client unsubscribed from ID: %s, Address: %s, Remaining viewers: %d", whatsappID, client.transport.RemoteAddr(), len(viewers))
+}
+
+// removeClient menghapus client dari semua whatsappID yang diikuti lalu menutup
+// antrean kirimnya. writePump mengirim close frame jika ada lalu menutup koneksi,
+// sehingga readPump ikut berhenti. Caller harus memegang h.mu.
+func (h *Hub) removeClient(client *Client) {
+	if client.closed {
+		return
+	}
+
+	for whatsappID := range client.subs {
+		h.removeViewer(client, whatsappID)
 	}
+	delete(h.conns, client)
+	client.closed = true
+	close(client.send)
+	h.logger.Infofctx(provider.AppLog, client.ctx, "Client disconnected with ID: %s, Address: %s, Dropped: %d", client.id, client.transport.RemoteAddr(), client.dropped.Load())
+}
+
+// closeClient memutus client dengan close code dan alasan yang dikirim ke browser.
+// Caller harus memegang h.mu.
+func (h *Hub) closeClient(client *Client, code int, text string) {
+	if client.closed {
+		return
+	}
+	client.closeCode = code
+	client.closeText = text
+	h.removeClient(client)
 }
 
 // GetwhatsappIDs mengembalikan daftar semua client ID yang terhubung
@@ -116,24 +374,75 @@ func (h *Hub) GetwhatsappIDs() []string {
 	return ids
 }
 
-func NewHub(logger provider.ILogger) *Hub {
+func NewHub(logger provider.ILogger, redis *redis.Client, maxViewers int) *Hub {
 	return &Hub{
 		logger:     logger,
-		clients:    make(map[string]*Client),
-		broadcast:  make(chan []byte),
+		redis:      redis,
+		pubsub:     redis.Subscribe(context.Background()),
+		clients:    make(map[string]map[*Client]struct{}),
+		conns:      make(map[*Client]struct{}),
+		gone:       make(map[string]chan struct{}),
+		maxViewers: maxViewers,
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		commands:   defaultCommands(),
+		done:       make(chan struct{}),
+		replay:     newReplayBuffer(),
+		polls:      make(map[pollKey]*Poll),
+		resync:     make(chan struct{}, 1),
+		controls:   make(map[string]*controlWatch),
+		replicaID:  uuid.New().String(),
 	}
 }
 
-func (h *Hub) Run() {
+// Run melayani registrasi dan unregistrasi client sampai ctx dibatalkan
+func (h *Hub) Run(ctx context.Context) {
+	defer close(h.done)
+	go h.listen()
+	go h.syncSubscriptions(ctx)
+
+	pruneTicker := time.NewTicker(time.Minute)
+	defer pruneTicker.Stop()
+
 	for {
 		select {
+		case now := <-pruneTicker.C:
+			h.replay.prune(now)
+			// Ulangi subscribe/unsubscribe yang sebelumnya gagal
+			h.notifySubscriptions()
+
+		case <-ctx.Done():
+			h.logger.Infofctx(provider.AppLog, ctx, "Hub stopped: %v", context.Cause(ctx))
+			return
+
 		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client.id] = client
-			h.logger.Infofctx(provider.AppLog, client.ctx, "Client connected with ID: %s, Address: %s", client.id, client.conn.RemoteAddr())
-			h.mu.Unlock()
+			// Client yang menerima replay mengambil h.mu lewat lockForReplay
+			// agar pesan yang perlu dirender tidak dirender sambil memegang lock
+			replay := client.replayFrom != nil || client.resume
+			if replay {
+				client.replayFrom = h.lockForReplay(client, client.id, client.since, client.replayFrom)
+			} else {
+				h.mu.Lock()
+			}
+			if h.shuttingDown {
+				client.closed = true
+				h.mu.Unlock()
+
+				h.rejectClient(client, ErrHubClosed.Error(), websocket.CloseGoingAway, ErrHubClosed.Error())
+				client.registered <- ErrHubClosed
+				continue
+			}
+			if err := h.addViewer(client, client.id); err != nil {
+				client.closed = true
+				h.mu.Unlock()
+
+				h.logger.Infofctx(provider.AppLog, client.ctx, "Viewer limit reached for ID: %s, rejecting Address: %s", client.id, client.transport.RemoteAddr())
+				h.rejectClient(client, fmt.Sprintf("Viewer limit of %d reached for whatsappID %s", h.maxViewers, client.id), websocket.ClosePolicyViolation, ErrViewerLimit.Error())
+				client.registered <- err
+				continue
+			}
+
+			h.conns[client] = struct{}{}
 
 			message := model.WSMessage{
 				MsgStatus:  true,
@@ -142,87 +451,128 @@ func (h *Hub) Run() {
 				Data:       "Webstream Connected to Server",
 				Timestamp:  time.Now(),
 			}
-			h.EmitMessageToClient(client.ctx, client.id, message)
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client.id]; ok {
-				delete(h.clients, client.id)
-				close(client.send)
-				client.conn.Close()
-				h.logger.Infofctx(provider.AppLog, client.ctx, "Client disconnected with ID: %s, Address: %s", client.id, client.conn.RemoteAddr())
+			if msgBytes, err := json.Marshal(message); err == nil {
+				h.enqueue(client, msgBytes)
+			}
+			// Kirim pesan yang terlewat atau QR terakhir sebelum pesan live
+			if replay {
+				h.replayTo(client, client.id, client.since, client.replayFrom)
+				client.replayFrom = nil
 			}
 			h.mu.Unlock()
+			client.registered <- nil
 
-		case message := <-h.broadcast:
+		case client := <-h.unregister:
 			h.mu.Lock()
-			for _, client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client.id)
-				}
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
 		}
 	}
 }
 
-func (c *Client) readPump(h *Hub) {
+// rejectClient mengirim pesan error ke client yang belum terdaftar lalu menutup koneksinya
+func (h *Hub) rejectClient(client *Client, reason string, closeCode int, closeText string) {
+	msgBytes, err := json.Marshal(model.WSMessage{
+		MsgStatus:  false,
+		Type:       "error",
+		WhatsappId: client.id,
+		Data:       reason,
+		Timestamp:  time.Now(),
+	})
+	if err == nil {
+		client.send <- msgBytes
+	}
+
+	// writePump akan mengirim close frame setelah channel send ditutup
+	client.closeCode = closeCode
+	client.closeText = closeText
+	close(client.send)
+}
+
+// readPump membaca command dari WebSocket dan mendeteksi koneksi yang putus
+func (c *Client) readPump(h *Hub, conn *websocket.Conn) {
 	defer func() {
-		h.unregister <- c
-		c.conn.Close()
+		h.unregisterClient(c)
+		conn.Close()
+		h.pumps.Done()
 	}()
+
+	// Koneksi half-open terdeteksi saat pong tidak datang dalam pong_wait
+	pongWait := wsPongWait()
+	conn.SetReadLimit(wsMaxMessageSize())
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				h.logger.Infofctx(provider.AppLog, c.ctx, "Read error for ID: %s, Address: %s: %v", c.id, c.transport.RemoteAddr(), err)
+			}
 			break
 		}
 		h.logger.Debugfctx(provider.AppLog, c.ctx, "Received: %s", message)
-		h.broadcast <- message
+		h.dispatchCommand(c, message)
 	}
 }
 
-func (c *Client) writePump() {
-	for msg := range c.send {
-		err := c.conn.WriteMessage(websocket.TextMessage, msg)
-		if err != nil {
-			break
-		}
+func ServeWS(h *Hub, w http.ResponseWriter, r *http.Request) error {
+	whatsappID := RequestWhatsappID(r)
+	if err := h.checkViewerLimit(w, whatsappID); err != nil {
+		return err
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Errorfctx(provider.AppLog, r.Context(), false, "Upgrade error: %v", err)
+		return err
 	}
+
+	client := h.newClient(r, whatsappID, &wsTransport{conn: conn}, wsPingInterval())
+	err = h.registerClient(client)
+
+	// Pump tetap dijalankan untuk client yang ditolak agar pesan penolakan dan close frame terkirim
+	h.pumps.Add(2)
+	go client.readPump(h, conn)
+	go client.writePump(h)
+	return err
 }
 
-func ServeWS(h *Hub, w http.ResponseWriter, r *http.Request) {
-	// Ambil client ID dari query parameter
-	whatsappID := r.URL.Query().Get("wa_id")
-	if whatsappID == "" {
-		whatsappID = r.Header.Get("Whatsapp-ID")
+// RequestWhatsappID mengambil whatsappID dari ?wa_id= atau header Whatsapp-ID
+func RequestWhatsappID(r *http.Request) string {
+	if whatsappID := r.URL.Query().Get("wa_id"); whatsappID != "" {
+		return whatsappID
 	}
+	return r.Header.Get("Whatsapp-ID")
+}
 
-	// Cek apakah client ID sudah ada
-	// h.mu.Lock()
-	// if _, exists := h.clients[whatsappID]; exists {
-	// 	h.mu.Unlock()
-	// 	http.Error(w, "Client ID already connected", http.StatusConflict)
-	// 	return
-	// }
-	// h.mu.Unlock()
+// checkViewerLimit menolak koneksi lebih awal dengan 429 jika jumlah viewer
+// whatsappID sudah mencapai batas, sebelum koneksi di-upgrade atau dijadikan
+// stream. registerClient tetap memeriksa ulang batas saat mendaftarkan client.
+func (h *Hub) checkViewerLimit(w http.ResponseWriter, whatsappID string) error {
+	if h.maxViewers > 0 && h.ViewerCount(whatsappID) >= h.maxViewers {
+		http.Error(w, fmt.Sprintf("Viewer limit of %d reached for whatsappID %s", h.maxViewers, whatsappID), http.StatusTooManyRequests)
+		return ErrViewerLimit
+	}
+	return nil
+}
 
+// RejectWS meng-upgrade koneksi hanya untuk mengirim satu pesan penolakan,
+// diikuti close frame, tanpa mendaftarkan client ke Hub
+func RejectWS(h *Hub, w http.ResponseWriter, r *http.Request, message model.WSMessage, closeCode int) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		h.logger.Errorfctx(provider.AppLog, r.Context(), false, "Upgrade error: %v", err)
 		return
 	}
+	defer conn.Close()
 
-	client := &Client{
-		ctx:  r.Context(),
-		id:   whatsappID,
-		conn: conn,
-		send: make(chan []byte, 256),
+	if msgBytes, err := json.Marshal(message); err == nil {
+		conn.WriteMessage(websocket.TextMessage, msgBytes)
 	}
-	h.register <- client
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, message.Type), time.Now().Add(time.Second))
 
-	go client.readPump(h)
-	go client.writePump()
+	h.logger.Infofctx(provider.AppLog, r.Context(), "Client rejected with ID: %s, Address: %s, Reason: %s", message.WhatsappId, conn.RemoteAddr(), message.Data)
 }
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"qrstreamer/util"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultUserClaim = "sub"
+
+// JWTVerifier memverifikasi token HS256 dan/atau RS256 sesuai konfigurasi auth
+type JWTVerifier struct {
+	secret    []byte
+	keys      map[string]*rsa.PublicKey // map[kid]public key dari file JWKS
+	methods   []string
+	userClaim string
+	options   []jwt.ParserOption
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func NewJWTVerifier() (*JWTVerifier, error) {
+	cfg := util.Configuration.Auth
+
+	v := &JWTVerifier{
+		secret:    []byte(cfg.HS256Secret),
+		keys:      make(map[string]*rsa.PublicKey),
+		userClaim: cfg.UserClaim,
+	}
+	if v.userClaim == "" {
+		v.userClaim = defaultUserClaim
+	}
+
+	if len(v.secret) > 0 {
+		v.methods = append(v.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+		v.methods = append(v.methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(v.methods) == 0 {
+		return nil, errors.New("auth requires hs256_secret or jwks_file")
+	}
+
+	v.options = []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		v.options = append(v.options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		v.options = append(v.options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return v, nil
+}
+
+// loadJWKS membaca public key RSA dari file JWKS lokal
+func (v *JWTVerifier) loadJWKS(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %w", err)
+	}
+
+	var set jwks
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("failed to parse jwks file: %w", err)
+	}
+
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return fmt.Errorf("invalid jwks modulus for kid %q: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return fmt.Errorf("invalid jwks exponent for kid %q: %w", key.Kid, err)
+		}
+
+		v.keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(v.keys) == 0 {
+		return errors.New("jwks file contains no RSA signing keys")
+	}
+	return nil
+}
+
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		// Token tanpa kid diterima jika JWKS hanya berisi satu key
+		if kid == "" && len(v.keys) == 1 {
+			for _, key := range v.keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// Verify memvalidasi token dan mengembalikan user_id dari claim yang dikonfigurasi
+func (v *JWTVerifier) Verify(tokenString string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc, v.options...); err != nil {
+		return "", err
+	}
+
+	userID, _ := claims[v.userClaim].(string)
+	if userID == "" {
+		return "", fmt.Errorf("token has no %s claim", v.userClaim)
+	}
+	return userID, nil
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"qrstreamer/util"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func NewPostgresConnection(ctx context.Context) (*pgxpool.Pool, error) {
+	cfg := util.Configuration.Postgres
+
+	// Format Postgres URL: postgres://<username>:<password>@<host>:<port>/<database>?<options>
+	dsn := fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?%s",
+		url.QueryEscape(cfg.Username),
+		url.QueryEscape(cfg.Password),
+		cfg.Host,
+		cfg.Port,
+		cfg.Database,
+		strings.Join(cfg.Options, "&"),
+	)
+
+	poolCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres url: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxConns)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create postgres pool: %w", err)
+	}
+
+	// Test koneksi
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	return pool, nil
+}
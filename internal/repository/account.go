@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AccountRepository membaca tabel whatsapp_accounts
+type AccountRepository interface {
+	GetByID(ctx context.Context, accountID string) (*model.WhatsappAccount, error)
+	GetBySenderJID(ctx context.Context, senderJid string) (*model.WhatsappAccount, error)
+	ListSenderJIDsByUser(ctx context.Context, userID string) ([]string, error)
+	UpdateConnectStatus(ctx context.Context, accountID string, status string, lastQRAt *time.Time, connectedAt *time.Time) error
+}
+
+type accountRepository struct {
+	logger provider.ILogger
+	db     *pgxpool.Pool
+}
+
+func NewAccountRepository(logger provider.ILogger, db *pgxpool.Pool) AccountRepository {
+	return &accountRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// GetByID mengembalikan akun termasuk yang sudah di-soft-delete, caller yang
+// memutuskan apakah DeletedAt membuat akun tidak bisa dipakai
+func (r *accountRepository) GetByID(ctx context.Context, accountID string) (*model.WhatsappAccount, error) {
+	if _, err := uuid.Parse(accountID); err != nil {
+		return nil, fmt.Errorf("%w: invalid account_id %s", ErrNotFound, accountID)
+	}
+
+	const query = `
+		SELECT ` + accountColumns + `
+		FROM whatsapp_accounts
+		WHERE account_id = $1`
+
+	account, err := scanAccount(r.db.QueryRow(ctx, query, accountID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: account %s", ErrNotFound, accountID)
+		}
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error query whatsapp_accounts: %v", err)
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetBySenderJID mengembalikan akun yang belum dihapus dengan sender_jid tersebut
+func (r *accountRepository) GetBySenderJID(ctx context.Context, senderJid string) (*model.WhatsappAccount, error) {
+	const query = `
+		SELECT ` + accountColumns + `
+		FROM whatsapp_accounts
+		WHERE sender_jid = $1 AND deleted_at IS NULL`
+
+	account, err := scanAccount(r.db.QueryRow(ctx, query, senderJid))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: no account for sender_jid %s", ErrNotFound, senderJid)
+		}
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error query whatsapp_accounts: %v", err)
+		return nil, err
+	}
+	return account, nil
+}
+
+// ListSenderJIDsByUser mengembalikan sender_jid semua akun milik userID yang belum dihapus
+func (r *accountRepository) ListSenderJIDsByUser(ctx context.Context, userID string) ([]string, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, nil
+	}
+
+	const query = `
+		SELECT sender_jid
+		FROM whatsapp_accounts
+		WHERE user_id = $1 AND deleted_at IS NULL AND sender_jid IS NOT NULL`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error query whatsapp_accounts of user %s: %v", userID, err)
+		return nil, err
+	}
+	senderJids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error scan whatsapp_accounts of user %s: %v", userID, err)
+		return nil, err
+	}
+	return senderJids, nil
+}
+
+// accountColumns adalah kolom whatsapp_accounts yang dibaca scanAccount
+const accountColumns = `account_id, user_id, account_name, account_alias, phone_number, sender_jid,
+		       connect_status::text, is_active, deleted_at`
+
+func scanAccount(row pgx.Row) (*model.WhatsappAccount, error) {
+	var account model.WhatsappAccount
+	err := row.Scan(
+		&account.AccountID,
+		&account.UserID,
+		&account.AccountName,
+		&account.AccountAlias,
+		&account.PhoneNumber,
+		&account.SenderJID,
+		&account.ConnectStatus,
+		&account.IsActive,
+		&account.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// UpdateConnectStatus mengubah connect_status, dan last_qr_at / connected_at
+// jika nilainya diberikan
+func (r *accountRepository) UpdateConnectStatus(ctx context.Context, accountID string, status string, lastQRAt *time.Time, connectedAt *time.Time) error {
+	const query = `
+		UPDATE whatsapp_accounts
+		SET connect_status = $2::connect_status_enum,
+		    last_qr_at = COALESCE($3, last_qr_at),
+		    connected_at = COALESCE($4, connected_at),
+		    updated_at = now()
+		WHERE account_id = $1`
+
+	if _, err := r.db.Exec(ctx, query, accountID, status, lastQRAt, connectedAt); err != nil {
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error update connect_status of %s: %v", accountID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxUserAgentLen mengikuti whatsapp_account_states.user_agent VARCHAR(255)
+const maxUserAgentLen = 255
+
+// AccountEventRepository mencatat siklus pairing ke whatsapp_account_states
+// dan whatsapp_web.account_events
+type AccountEventRepository interface {
+	Record(ctx context.Context, event *model.AccountEvent) error
+}
+
+type accountEventRepository struct {
+	logger provider.ILogger
+	db     *pgxpool.Pool
+}
+
+func NewAccountEventRepository(logger provider.ILogger, db *pgxpool.Pool) AccountEventRepository {
+	return &accountEventRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// Record menulis event ke kedua tabel dalam satu transaksi
+func (r *accountEventRepository) Record(ctx context.Context, event *model.AccountEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		const insertState = `
+			INSERT INTO whatsapp_account_states (account_id, event_type, event_message, ip_address, user_agent, created_at)
+			VALUES ($1, $2, $3, $4::inet, $5, $6)`
+		if _, err := tx.Exec(ctx, insertState,
+			event.AccountID,
+			event.EventType,
+			nullString(event.Message),
+			nullIP(event.IPAddress),
+			nullString(truncate(event.UserAgent, maxUserAgentLen)),
+			event.Timestamp,
+		); err != nil {
+			return err
+		}
+
+		const insertEvent = `
+			INSERT INTO whatsapp_web.account_events (account_id, event_type, "timestamp", data)
+			VALUES ($1, $2, $3, $4)`
+		_, err := tx.Exec(ctx, insertEvent, event.AccountID, event.EventType, event.Timestamp, data)
+		return err
+	})
+	if err != nil {
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error insert account event %s for %s: %v", event.EventType, event.AccountID, err)
+		return err
+	}
+	return nil
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nullIP mengembalikan nil untuk alamat kosong atau tidak valid agar kolom INET tetap NULL
+func nullIP(s string) *string {
+	if net.ParseIP(s) == nil {
+		return nil
+	}
+	return &s
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
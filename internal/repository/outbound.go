@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OutboundRepository menyimpan dan membaca whatsapp_web.message_outbounds
+type OutboundRepository interface {
+	CreateBySenderJid(ctx context.Context, senderJid string, msg *model.MessageOutbound) error
+	ListByAccount(ctx context.Context, accountID string, filter model.OutboundFilter) ([]model.MessageOutbound, error)
+}
+
+type outboundRepository struct {
+	logger provider.ILogger
+	db     *pgxpool.Pool
+}
+
+func NewOutboundRepository(logger provider.ILogger, db *pgxpool.Pool) OutboundRepository {
+	return &outboundRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateBySenderJid mencatat pesan keluar untuk akun pemilik senderJid dan
+// mengisi OutboundID, AccountID serta SentAt pada msg
+func (r *outboundRepository) CreateBySenderJid(ctx context.Context, senderJid string, msg *model.MessageOutbound) error {
+	const query = `
+		INSERT INTO whatsapp_web.message_outbounds (account_id, message_id, recipient, message_type, data)
+		SELECT account_id, $2, $3, $4, $5
+		FROM whatsapp_accounts
+		WHERE sender_jid = $1 AND deleted_at IS NULL
+		RETURNING outbound_id, account_id, sent_at`
+
+	err := r.db.QueryRow(ctx, query, senderJid, msg.MessageID, msg.Recipient, msg.MessageType, msg.Data).
+		Scan(&msg.OutboundID, &msg.AccountID, &msg.SentAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: no account for sender_jid %s", ErrNotFound, senderJid)
+		}
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error insert message_outbounds: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListByAccount mengembalikan pesan keluar akun, terbaru lebih dulu
+func (r *outboundRepository) ListByAccount(ctx context.Context, accountID string, filter model.OutboundFilter) ([]model.MessageOutbound, error) {
+	const query = `
+		SELECT outbound_id, account_id, message_id, recipient, message_type, sent_at, data
+		FROM whatsapp_web.message_outbounds
+		WHERE account_id = $1
+		  AND deleted_at IS NULL
+		  AND ($2::timestamptz IS NULL OR sent_at >= $2)
+		  AND ($3::timestamptz IS NULL OR sent_at < $3)
+		ORDER BY sent_at DESC
+		LIMIT $4 OFFSET $5`
+
+	rows, err := r.db.Query(ctx, query, accountID, filter.From, filter.To, filter.Limit, filter.Offset)
+	if err != nil {
+		r.logger.Errorfctx(provider.PostgresLog, ctx, false, "Error query message_outbounds: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.MessageOutbound{}
+	for rows.Next() {
+		var msg model.MessageOutbound
+		if err := rows.Scan(&msg.OutboundID, &msg.AccountID, &msg.MessageID, &msg.Recipient, &msg.MessageType, &msg.SentAt, &msg.Data); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,6 @@
+package repository
+
+import "errors"
+
+// ErrNotFound dikembalikan saat baris yang dicari tidak ada
+var ErrNotFound = errors.New("record not found")
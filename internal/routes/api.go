@@ -0,0 +1,442 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"qrstreamer/internal/handler"
+	"qrstreamer/internal/provider"
+	"qrstreamer/internal/service"
+	"qrstreamer/model"
+	"qrstreamer/model/constant"
+	"qrstreamer/util"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// emitTypes adalah tipe pesan yang boleh dikirim lewat endpoint emit. Tipe
+// yang dipakai stream QR seperti qr_code tidak boleh dipalsukan lewat REST.
+var emitTypes = map[string]bool{
+	"broadcast": true,
+	"notice":    true,
+}
+
+func registerAPIRoutes(hub *handler.Hub, svc service.QRStreamer, gw service.Gateway, verifier *provider.JWTVerifier) {
+
+	// Semua endpoint REST membutuhkan token yang valid
+	protected := func(next http.HandlerFunc) http.HandlerFunc {
+		return withRequestID(authenticate(verifier, next))
+	}
+
+	// Emit hanya menjangkau client milik user yang memanggil
+	http.HandleFunc("POST /api/emit", protected(func(w http.ResponseWriter, r *http.Request) {
+		var req model.EmitRequest
+		if err := decodeOptionalJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		message, err := newEmitMessage(req, "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		msgBytes, err := json.Marshal(message)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		clients := ownClients(hub, userIDFromContext(r.Context()))
+		hub.EmitToClients(clients, msgBytes)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"recipients": len(clients),
+		})
+	}))
+
+	http.HandleFunc("POST /api/emit/client", protected(func(w http.ResponseWriter, r *http.Request) {
+		whatsappID := r.URL.Query().Get("wa_id")
+		if whatsappID == "" {
+			whatsappID = r.URL.Query().Get("client_id")
+		}
+		if whatsappID == "" {
+			writeError(w, http.StatusBadRequest, errors.New("wa_id is required"))
+			return
+		}
+
+		var req model.EmitRequest
+		if err := decodeOptionalJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		message, err := newEmitMessage(req, whatsappID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := svc.Authorize(r.Context(), userIDFromContext(r.Context()), whatsappID); err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+
+		recipients := hub.ViewerCount(whatsappID)
+		if recipients == 0 {
+			writeError(w, http.StatusNotFound, errors.New("no client connected for wa_id "+whatsappID))
+			return
+		}
+
+		if err := hub.EmitMessageToClient(r.Context(), whatsappID, message); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"recipients": recipients,
+		})
+	}))
+
+	http.HandleFunc("GET /api/clients", protected(func(w http.ResponseWriter, r *http.Request) {
+		clients := ownClients(hub, userIDFromContext(r.Context()))
+
+		infos := make([]model.ClientInfo, 0, len(clients))
+		for _, client := range clients {
+			infos = append(infos, client.Info())
+		}
+		writeJSON(w, http.StatusOK, infos)
+	}))
+
+	// Operator melihat semua client beserta counter dropped untuk memantau client lambat
+	http.HandleFunc("GET /api/admin/clients", protected(requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		clients := hub.GetClients()
+
+		infos := make([]model.ClientInfo, 0, len(clients))
+		for _, client := range clients {
+			info := client.Info()
+			info.UserId = userIDFromContext(client.Context())
+			infos = append(infos, info)
+		}
+		writeJSON(w, http.StatusOK, infos)
+	})))
+
+	http.HandleFunc("GET /api/devices", protected(func(w http.ResponseWriter, r *http.Request) {
+		devices, err := gw.GetDevices(r.Context())
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		// wacore mengembalikan device semua akun, tampilkan hanya milik user
+		devices, err = svc.OwnDevices(r.Context(), userIDFromContext(r.Context()), devices)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, devices)
+	}))
+
+	http.HandleFunc("POST /api/send-message", protected(func(w http.ResponseWriter, r *http.Request) {
+		var req model.SendTextRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid JSON body: "+err.Error()))
+			return
+		}
+		if req.To == "" || req.Message == "" {
+			writeError(w, http.StatusBadRequest, errors.New("to and message are required"))
+			return
+		}
+		if req.SenderJid != "" {
+			if err := svc.AuthorizeSender(r.Context(), userIDFromContext(r.Context()), req.SenderJid); err != nil {
+				writeAuthorizeError(w, err)
+				return
+			}
+		}
+
+		result, err := gw.Send(r.Context(), model.SendMessageRequest{
+			SenderJid: req.SenderJid,
+			To:        req.To,
+			Type:      "text",
+			Text:      req.Message,
+		})
+		if err != nil {
+			writeSendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}))
+
+	http.HandleFunc("POST /api/messages", protected(func(w http.ResponseWriter, r *http.Request) {
+		var req model.SendMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid JSON body: "+err.Error()))
+			return
+		}
+		// sender_jid kosong ditolak gw.Send sebagai payload tidak valid
+		if req.SenderJid != "" {
+			if err := svc.AuthorizeSender(r.Context(), userIDFromContext(r.Context()), req.SenderJid); err != nil {
+				writeAuthorizeError(w, err)
+				return
+			}
+		}
+
+		result, err := gw.Send(r.Context(), req)
+		if err != nil {
+			writeSendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}))
+
+	http.HandleFunc("GET /api/accounts/{sender_jid}/contacts", protected(func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseClientDataQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		senderJid := r.PathValue("sender_jid")
+		if err := svc.AuthorizeSender(r.Context(), userIDFromContext(r.Context()), senderJid); err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+
+		page, err := gw.GetContacts(r.Context(), senderJid, query)
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}))
+
+	http.HandleFunc("GET /api/accounts/{sender_jid}/groups", protected(func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseClientDataQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		senderJid := r.PathValue("sender_jid")
+		if err := svc.AuthorizeSender(r.Context(), userIDFromContext(r.Context()), senderJid); err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+
+		page, err := gw.GetGroups(r.Context(), senderJid, query)
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}))
+
+	http.HandleFunc("GET /api/accounts/{account_id}/messages", protected(func(w http.ResponseWriter, r *http.Request) {
+		accountID := r.PathValue("account_id")
+		if _, err := uuid.Parse(accountID); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("account_id must be a UUID"))
+			return
+		}
+
+		filter, err := parseOutboundFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := svc.Authorize(r.Context(), userIDFromContext(r.Context()), accountID); err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+
+		messages, err := gw.ListSentMessages(r.Context(), accountID, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, messages)
+	}))
+}
+
+// parseOutboundFilter membaca ?from=, ?to= (RFC3339), ?limit= dan ?offset=
+func parseOutboundFilter(r *http.Request) (model.OutboundFilter, error) {
+	filter := model.OutboundFilter{Limit: defaultPerPage}
+
+	for name, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := r.URL.Query().Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC3339 timestamp", name)
+			}
+			*dst = &t
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > maxPerPage {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPerPage)
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			return filter, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return filter, nil
+}
+
+// parseClientDataQuery membaca ?q=, ?page= dan ?per_page= untuk endpoint kontak/grup
+func parseClientDataQuery(r *http.Request) (model.ClientDataQuery, error) {
+	query := model.ClientDataQuery{
+		Search:  r.URL.Query().Get("q"),
+		Page:    1,
+		PerPage: defaultPerPage,
+	}
+
+	var err error
+	if v := r.URL.Query().Get("page"); v != "" {
+		if query.Page, err = strconv.Atoi(v); err != nil || query.Page < 1 {
+			return query, errors.New("page must be a positive integer")
+		}
+	}
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		if query.PerPage, err = strconv.Atoi(v); err != nil || query.PerPage < 1 || query.PerPage > maxPerPage {
+			return query, fmt.Errorf("per_page must be between 1 and %d", maxPerPage)
+		}
+	}
+	return query, nil
+}
+
+// withRequestID menambahkan request ID ke context untuk logging
+func withRequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), constant.CtxReqIDKey, uuid.New().String())
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// newEmitMessage membentuk WSMessage dari body emit, dengan nilai default untuk tes manual.
+// Tipe di luar emitTypes ditolak.
+func newEmitMessage(req model.EmitRequest, whatsappID string) (model.WSMessage, error) {
+	if req.Type == "" {
+		req.Type = "broadcast"
+	}
+	if !emitTypes[req.Type] {
+		return model.WSMessage{}, fmt.Errorf("type %q is not allowed, use broadcast or notice", req.Type)
+	}
+	if req.Data == "" {
+		req.Data = "Manual emit from REST API"
+	}
+	return model.WSMessage{
+		MsgStatus:  true,
+		Type:       req.Type,
+		WhatsappId: whatsappID,
+		Data:       req.Data,
+		Timestamp:  time.Now(),
+	}, nil
+}
+
+// ownClients mengembalikan client yang terhubung atas nama userID
+func ownClients(hub *handler.Hub, userID string) []*handler.Client {
+	var clients []*handler.Client
+	for _, client := range hub.GetClients() {
+		if userIDFromContext(client.Context()) == userID {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// requireAdmin menolak user yang tidak terdaftar di auth.admin_user_ids
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(util.Configuration.Auth.AdminUserIDs, userIDFromContext(r.Context())) {
+			writeError(w, http.StatusForbidden, errors.New("admin access required"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decodeOptionalJSON membaca body JSON jika ada, body kosong dianggap valid
+func decodeOptionalJSON(r *http.Request, v interface{}) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errors.New("invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(model.APIResponse{
+		MsgStatus: true,
+		Data:      data,
+	})
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(model.APIResponse{
+		MsgStatus: false,
+		Error:     err.Error(),
+	})
+}
+
+// writeAuthorizeError memetakan error kepemilikan akun ke status HTTP
+func writeAuthorizeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrAccountNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, service.ErrForbidden):
+		writeError(w, http.StatusForbidden, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// writeSendError membedakan payload tidak valid dari error wacore
+func writeSendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrInvalidMessage) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeGRPCError(w, err)
+}
+
+// writeGRPCError memetakan error gRPC wacore ke status HTTP
+func writeGRPCError(w http.ResponseWriter, err error) {
+	if errors.Is(err, handler.ErrGRPCNotConnected) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.InvalidArgument:
+		writeError(w, http.StatusBadRequest, errors.New(st.Message()))
+	case codes.NotFound:
+		writeError(w, http.StatusNotFound, errors.New(st.Message()))
+	case codes.Unavailable:
+		writeError(w, http.StatusServiceUnavailable, errors.New(st.Message()))
+	case codes.DeadlineExceeded:
+		writeError(w, http.StatusGatewayTimeout, errors.New(st.Message()))
+	default:
+		writeError(w, http.StatusBadGateway, errors.New(st.Message()))
+	}
+}
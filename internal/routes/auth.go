@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model/constant"
+	"strings"
+)
+
+// wsTokenProtocol adalah subprotocol penanda token, client mengirim
+// Sec-WebSocket-Protocol: bearer, <jwt>
+const wsTokenProtocol = "bearer"
+
+// authenticate memverifikasi JWT dari header Authorization atau
+// Sec-WebSocket-Protocol lalu menyimpan user_id dari claim ke context.
+// Verifier nil hanya terjadi jika auth.enabled=false dan auth.dev_trust_user_header
+// diset; user_id lalu dibaca dari ?user_id= atau header User-ID yang bisa
+// dipalsukan, sehingga mode ini hanya untuk pengembangan lokal.
+func authenticate(verifier *provider.JWTVerifier, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var userID string
+		if verifier == nil {
+			userID = r.URL.Query().Get("user_id")
+			if userID == "" {
+				userID = r.Header.Get("User-ID")
+			}
+			if userID == "" {
+				writeError(w, http.StatusUnauthorized, errors.New("user ID is required. Use ?user_id=your_user_id or User-ID header"))
+				return
+			}
+		} else {
+			token := bearerToken(r)
+			if token == "" {
+				writeError(w, http.StatusUnauthorized, errors.New("bearer token is required"))
+				return
+			}
+
+			var err error
+			userID, err = verifier.Verify(token)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid token: "+err.Error()))
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), constant.CtxUserIDKey, userID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// bearerToken mengambil token dari "Authorization: Bearer <jwt>", dari
+// subprotocol WebSocket "bearer, <jwt>", atau dari ?access_token= khusus /sse
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.TrimSpace(protocols[i]) == wsTokenProtocol {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+
+	// EventSource tidak bisa mengirim header, token untuk /sse dikirim lewat query
+	if r.URL.Path == "/sse" {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// userIDFromContext mengembalikan user_id yang sudah diautentikasi
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(constant.CtxUserIDKey).(string)
+	return userID
+}
@@ -2,49 +2,227 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"path"
 	"qrstreamer/internal/handler"
+	"qrstreamer/internal/provider"
 	"qrstreamer/internal/service"
+	"qrstreamer/model"
 	"qrstreamer/model/constant"
+	"qrstreamer/util"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
-func RegisterRoutes(hub *handler.Hub, svc service.QRStreamer) {
+func RegisterRoutes(hub *handler.Hub, svc service.QRStreamer, gw service.Gateway, verifier *provider.JWTVerifier) {
 
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), constant.CtxReqIDKey, fmt.Sprintf("%s", uuid.New().String()))
-		r = r.WithContext(ctx)
+	registerAPIRoutes(hub, svc, gw, verifier)
 
-		whatsappID := r.URL.Query().Get("wa_id")
-		userID := r.URL.Query().Get("user_id")
-		if whatsappID == "" {
-			whatsappID = r.Header.Get("Whatsapp-ID")
+	registerWSCommands(hub, svc)
+
+	http.HandleFunc("/ws", withRequestID(authenticate(verifier, func(w http.ResponseWriter, r *http.Request) {
+		whatsappID, ok := requireWhatsappID(w, r)
+		if !ok {
+			return
+		}
+		userID := userIDFromContext(r.Context())
+		r = withClientInfo(r)
+
+		// Pastikan user_id adalah pemilik wa_id sebelum QR pairing dikirim
+		if err := authorizeViewer(r.Context(), svc, userID, whatsappID); err != nil {
+			if errors.Is(err, service.ErrForbidden) {
+				handler.RejectWS(hub, w, r, model.WSMessage{
+					MsgStatus:  false,
+					Type:       "forbidden",
+					WhatsappId: whatsappID,
+					Data:       err.Error(),
+					Timestamp:  time.Now(),
+				}, websocket.ClosePolicyViolation)
+				return
+			}
+			writeAuthorizeError(w, err)
+			return
+		}
+
+		if err := handler.ServeWS(hub, w, r); err != nil {
+			return
+		}
+
+		// Koneksi sudah di-hijack, kegagalan stream dilaporkan lewat WebSocket
+		startStream(hub, svc, r.Context(), userID, whatsappID)
+	})))
+
+	// Fallback Server-Sent Events untuk client di balik proxy yang memblokir WebSocket
+	http.HandleFunc("GET /sse", withRequestID(authenticate(verifier, func(w http.ResponseWriter, r *http.Request) {
+		whatsappID, ok := requireWhatsappID(w, r)
+		if !ok {
+			return
+		}
+		userID := userIDFromContext(r.Context())
+		r = withClientInfo(r)
+
+		if err := authorizeViewer(r.Context(), svc, userID, whatsappID); err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+
+		done, err := handler.ServeSSE(hub, w, r)
+		if done == nil {
+			return
+		}
+		if err == nil {
+			startStream(hub, svc, r.Context(), userID, whatsappID)
+		}
+
+		// ResponseWriter dipakai writePump sampai koneksi SSE selesai
+		<-done
+	})))
+
+	// Long polling untuk browser yang tidak bisa menahan koneksi streaming
+	http.HandleFunc("GET /poll", withRequestID(authenticate(verifier, func(w http.ResponseWriter, r *http.Request) {
+		whatsappID, ok := requireWhatsappID(w, r)
+		if !ok {
+			return
 		}
-		if userID == "" {
-			userID = r.Header.Get("User-ID")
+		userID := userIDFromContext(r.Context())
+		timeout, err := handler.PollTimeout(r.URL.Query().Get("timeout"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		r = withClientInfo(r)
+
+		if err := authorizeViewer(r.Context(), svc, userID, whatsappID); err != nil {
+			writeAuthorizeError(w, err)
+			return
 		}
-		if whatsappID == "" {
-			http.Error(w, "Whatsapp ID is required. Use ?id=your_whatsapp_id or Whatsapp-ID header", http.StatusBadRequest)
+
+		poll, err := handler.OpenPoll(hub, r, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, handler.ErrViewerLimit):
+				writeError(w, http.StatusTooManyRequests, err)
+			case errors.Is(err, handler.ErrHubClosed):
+				writeError(w, http.StatusServiceUnavailable, err)
+			default:
+				writeError(w, http.StatusInternalServerError, err)
+			}
 			return
 		}
-		if userID == "" {
-			http.Error(w, "User ID is required. Use ?user_id=your_user_id or User-ID header", http.StatusBadRequest)
+
+		// Stream QR hidup di luar request, viewer poll yang masih linger menjaganya tetap berjalan
+		if poll.First() {
+			go startStream(hub, svc, context.WithoutCancel(r.Context()), userID, whatsappID)
+		}
+
+		writeJSON(w, http.StatusOK, poll.Wait(r.Context(), timeout))
+	})))
+
+	http.HandleFunc("GET /qr/{file}", withRequestID(authenticate(verifier, func(w http.ResponseWriter, r *http.Request) {
+		// {file} berbentuk <wa_id>.png atau <wa_id>.svg
+		file := r.PathValue("file")
+		ext := path.Ext(file)
+		whatsappID := strings.TrimSuffix(file, ext)
+		if whatsappID == "" || (ext != ".png" && ext != ".svg") {
+			http.NotFound(w, r)
 			return
 		}
 
-		handler.ServeWS(hub, w, r)
+		r = withClientInfo(r)
+		qrCode, ttl, err := svc.GetCurrentQR(r.Context(), userIDFromContext(r.Context()), whatsappID)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrAccountNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, service.ErrForbidden):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, service.ErrAccountInactive):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, service.ErrAccountOnline):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, service.ErrQRNotReady):
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
 
-		if err := svc.StreamWhatsappQR(r.Context(), userID, whatsappID); err != nil {
+		var img []byte
+		contentType := "image/png"
+		if ext == ".svg" {
+			contentType = "image/svg+xml"
+			img, err = util.RenderQRSVG(qrCode, util.QRImageOptionsFromConfig())
+		} else {
+			img, err = util.RenderQRPNG(qrCode, util.QRImageOptionsFromConfig())
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-	})
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-QR-Expires-In", strconv.Itoa(int(ttl.Seconds())))
+		w.Write(img)
+	})))
+
+	http.HandleFunc("GET /api/accounts/{wa_id}/state", withRequestID(authenticate(verifier, func(w http.ResponseWriter, r *http.Request) {
+		status, err := svc.GetPairingState(r.Context(), userIDFromContext(r.Context()), r.PathValue("wa_id"))
+		if err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})))
 
 	// Default root
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, `WebSocket server running at ws://localhost:8080/ws`)
 	})
 }
+
+// requireWhatsappID membaca wa_id dari request untuk /ws, /sse dan /poll,
+// lalu menulis 400 dan mengembalikan false jika kosong
+func requireWhatsappID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	whatsappID := handler.RequestWhatsappID(r)
+	if whatsappID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("Whatsapp ID is required. Use ?wa_id=your_whatsapp_id or Whatsapp-ID header"))
+		return "", false
+	}
+	return whatsappID, true
+}
+
+// authorizeViewer memastikan userID boleh melihat stream whatsappID. Akun yang
+// tidak ditemukan tidak ditolak di sini karena startStream melaporkannya ke
+// viewer lewat stream.
+func authorizeViewer(ctx context.Context, svc service.QRStreamer, userID string, whatsappID string) error {
+	if err := svc.Authorize(ctx, userID, whatsappID); err != nil && !errors.Is(err, service.ErrAccountNotFound) {
+		return err
+	}
+	return nil
+}
+
+// withClientInfo menyimpan IP dan User-Agent client ke context untuk pencatatan
+// siklus pairing. X-Forwarded-For dipakai jika ada karena server berada di
+// belakang load balancer.
+func withClientInfo(r *http.Request) *http.Request {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		ip = strings.TrimSpace(first)
+	}
+
+	ctx := context.WithValue(r.Context(), constant.CtxClientIPKey, ip)
+	ctx = context.WithValue(ctx, constant.CtxUserAgentKey, r.UserAgent())
+	return r.WithContext(ctx)
+}
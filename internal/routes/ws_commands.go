@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"qrstreamer/internal/handler"
+	"qrstreamer/internal/service"
+	"qrstreamer/model"
+	"time"
+)
+
+var errNotSubscribed = errors.New("not subscribed to whatsappID")
+
+// registerWSCommands mendaftarkan command WebSocket yang membutuhkan service.
+// Semua command dijalankan atas nama user_id pemilik koneksi.
+func registerWSCommands(hub *handler.Hub, svc service.QRStreamer) {
+
+	hub.HandleCommand(model.WSCommandSubscribe, func(client *handler.Client, cmd model.WSCommand) (any, error) {
+		ctx := client.Context()
+		userID := userIDFromContext(ctx)
+
+		if err := authorizeViewer(ctx, svc, userID, cmd.WhatsappId); err != nil {
+			return nil, err
+		}
+		if err := hub.Subscribe(client, cmd.WhatsappId); err != nil {
+			return nil, err
+		}
+
+		go startStream(hub, svc, context.WithoutCancel(ctx), userID, cmd.WhatsappId)
+		return nil, nil
+	})
+
+	hub.HandleCommand(model.WSCommandUnsubscribe, func(client *handler.Client, cmd model.WSCommand) (any, error) {
+		if !hub.IsSubscribed(client, cmd.WhatsappId) {
+			return nil, errNotSubscribed
+		}
+		hub.Unsubscribe(client, cmd.WhatsappId)
+		return nil, nil
+	})
+
+	hub.HandleCommand(model.WSCommandRestartQR, func(client *handler.Client, cmd model.WSCommand) (any, error) {
+		if !hub.IsSubscribed(client, cmd.WhatsappId) {
+			return nil, errNotSubscribed
+		}
+
+		ctx := client.Context()
+		userID := userIDFromContext(ctx)
+		if err := svc.Authorize(ctx, userID, cmd.WhatsappId); err != nil {
+			return nil, err
+		}
+
+		go startStream(hub, svc, context.WithoutCancel(ctx), userID, cmd.WhatsappId)
+		return nil, nil
+	})
+
+	hub.HandleCommand(model.WSCommandCancel, func(client *handler.Client, cmd model.WSCommand) (any, error) {
+		if !hub.IsSubscribed(client, cmd.WhatsappId) {
+			return nil, errNotSubscribed
+		}
+
+		ctx := client.Context()
+		return nil, svc.CancelStream(ctx, userIDFromContext(ctx), cmd.WhatsappId)
+	})
+
+	hub.HandleCommand(model.WSCommandGetState, func(client *handler.Client, cmd model.WSCommand) (any, error) {
+		ctx := client.Context()
+		return svc.GetPairingState(ctx, userIDFromContext(ctx), cmd.WhatsappId)
+	})
+}
+
+// startStream menjalankan stream QR di luar request WebSocket dan melaporkan
+// kegagalan ke viewer whatsappID
+func startStream(hub *handler.Hub, svc service.QRStreamer, ctx context.Context, userID string, whatsappID string) {
+	if err := svc.StreamWhatsappQR(ctx, userID, whatsappID); err != nil {
+		hub.EmitMessageToClient(ctx, whatsappID, model.WSMessage{
+			MsgStatus:  false,
+			Type:       "error",
+			WhatsappId: whatsappID,
+			Data:       err.Error(),
+			Timestamp:  time.Now(),
+		})
+	}
+}
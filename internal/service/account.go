@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"qrstreamer/internal/provider"
+	"qrstreamer/internal/repository"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"strings"
+	"time"
+
+	proto "qrstreamer/model/pb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultAccountCacheTTL = 30 * time.Second
+
+var (
+	// ErrAccountInactive dikembalikan saat is_active=false
+	ErrAccountInactive = errors.New("account is inactive")
+	// ErrAccountOnline dikembalikan saat akun sudah terhubung dan tidak butuh QR
+	ErrAccountOnline = errors.New("account is already online")
+	// ErrForbidden dikembalikan saat user_id bukan pemilik akun
+	ErrForbidden = errors.New("forbidden")
+)
+
+// loadAccount membaca akun lewat cache Redis "waa:<whatsappID>", jika tidak
+// ada di cache dibaca dari Postgres lalu disimpan selama cache.account detik
+func (s *service) loadAccount(ctx context.Context, whatsappID string) (*model.WhatsappAccount, error) {
+	redisKey := fmt.Sprintf(waaKeyPrefix, whatsappID)
+
+	cached, err := s.redis.Get(ctx, redisKey).Bytes()
+	if err == nil {
+		var account model.WhatsappAccount
+		if err := json.Unmarshal(cached, &account); err == nil {
+			return &account, nil
+		}
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error decoding cached account %s, reloading", whatsappID)
+	} else if err != redis.Nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error Redis: %v", err)
+	}
+
+	account, err := s.accounts.GetByID(ctx, whatsappID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: WhatsappID %s not found", ErrAccountNotFound, whatsappID)
+		}
+		return nil, err
+	}
+
+	if encoded, err := json.Marshal(account); err == nil {
+		ttl := util.ConfigSeconds(util.Configuration.Cache.Account, defaultAccountCacheTTL)
+		if err := s.redis.Set(ctx, redisKey, encoded, ttl).Err(); err != nil {
+			s.logger.Errorfctx(provider.AppLog, ctx, false, "Error set account cache in Redis: %v", err)
+		}
+	}
+	return account, nil
+}
+
+// invalidateAccount menghapus cache akun setelah datanya berubah
+func (s *service) invalidateAccount(ctx context.Context, whatsappID string) {
+	if err := s.redis.Del(ctx, fmt.Sprintf(waaKeyPrefix, whatsappID)).Err(); err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error delete account cache in Redis: %v", err)
+	}
+}
+
+// Authorize memastikan userID adalah pemilik akun whatsappID
+func (s *service) Authorize(ctx context.Context, userID string, whatsappID string) error {
+	account, err := s.loadAccount(ctx, whatsappID)
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error load account %s: %v", whatsappID, err)
+		return err
+	}
+	return s.authorizeAccount(ctx, userID, account)
+}
+
+// AuthorizeSender memastikan userID adalah pemilik akun dengan sender_jid senderJid
+func (s *service) AuthorizeSender(ctx context.Context, userID string, senderJid string) error {
+	account, err := s.accounts.GetBySenderJID(ctx, senderJid)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: sender_jid %s not found", ErrAccountNotFound, senderJid)
+		}
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error load account by sender_jid %s: %v", senderJid, err)
+		return err
+	}
+	return s.authorizeAccount(ctx, userID, account)
+}
+
+// OwnDevices menyaring device wacore sehingga hanya device milik akun userID yang tersisa.
+// JID device (628xx:12@s.whatsapp.net) dicocokkan dengan sender_jid tanpa nomor device.
+func (s *service) OwnDevices(ctx context.Context, userID string, devices []*proto.DeviceItem) ([]*proto.DeviceItem, error) {
+	senderJids, err := s.accounts.ListSenderJIDsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]struct{}, len(senderJids))
+	for _, senderJid := range senderJids {
+		owned[bareJID(senderJid)] = struct{}{}
+	}
+
+	filtered := make([]*proto.DeviceItem, 0, len(devices))
+	for _, device := range devices {
+		if _, ok := owned[bareJID(device.GetJid())]; ok {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered, nil
+}
+
+// bareJID membuang nomor device dari JID, mis. 628xx:12@s.whatsapp.net menjadi 628xx@s.whatsapp.net
+func bareJID(jid string) string {
+	user, server, _ := strings.Cut(jid, "@")
+	user, _, _ = strings.Cut(user, ":")
+	return user + "@" + server
+}
+
+func (s *service) authorizeAccount(ctx context.Context, userID string, account *model.WhatsappAccount) error {
+	if account.UserID != userID {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "User %s is not the owner of WhatsappID %s", userID, account.AccountID)
+		return fmt.Errorf("%w: user %s does not own WhatsappID %s", ErrForbidden, userID, account.AccountID)
+	}
+	return nil
+}
+
+// checkAccount memastikan akun ada, dimiliki userID, belum dihapus, aktif dan belum online
+func (s *service) checkAccount(ctx context.Context, userID string, whatsappID string) error {
+	account, err := s.loadAccount(ctx, whatsappID)
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error load account %s: %v", whatsappID, err)
+		return err
+	}
+	if err := s.authorizeAccount(ctx, userID, account); err != nil {
+		return err
+	}
+
+	switch {
+	case account.DeletedAt != nil:
+		return fmt.Errorf("%w: WhatsappID %s has been deleted", ErrAccountNotFound, whatsappID)
+	case !account.IsActive:
+		return fmt.Errorf("%w: WhatsappID %s", ErrAccountInactive, whatsappID)
+	case account.ConnectStatus == "online":
+		return fmt.Errorf("%w: WhatsappID %s", ErrAccountOnline, whatsappID)
+	}
+	return nil
+}
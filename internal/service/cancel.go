@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"time"
+)
+
+// beginStream mencatat streamQR yang sedang berjalan, false jika service sedang dimatikan.
+// Caller yang menerima true harus memanggil s.running.Done saat selesai.
+func (s *service) beginStream() bool {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.running.Add(1)
+	return true
+}
+
+// trackStream mencatat cancel stream upstream yang sedang dipegang replica ini
+func (s *service) trackStream(whatsappID string, cancel context.CancelCauseFunc) {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+
+	s.streams[whatsappID] = cancel
+	if s.closing {
+		cancel(errServerShutdown)
+	}
+}
+
+func (s *service) untrackStream(whatsappID string) {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+
+	delete(s.streams, whatsappID)
+}
+
+// Shutdown membatalkan semua stream upstream yang dipegang replica ini lalu
+// menunggu stream tersebut selesai mencatat state dan melepas lease, atau ctx berakhir.
+// Stream baru yang dimulai setelahnya langsung ditolak.
+func (s *service) Shutdown(ctx context.Context) error {
+	s.streamsMu.Lock()
+	s.closing = true
+	s.logger.Infofctx(provider.AppLog, ctx, "Cancelling %d upstream stream(s)", len(s.streams))
+	for _, cancel := range s.streams {
+		cancel(errServerShutdown)
+	}
+	s.streamsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Upstream streams did not stop in time: %v", ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// CancelStream menghentikan stream QR whatsappID atas permintaan pemilik akun.
+// Jika stream dipegang replica lain, perintah cancel dikirim ke replica
+// pemilik lewat channel kontrol. Pemilik stream yang mengirim stream_cancelled
+// ke viewer setelah stream benar-benar berhenti dan lease dilepas.
+func (s *service) CancelStream(ctx context.Context, userID string, whatsappID string) error {
+	if err := s.Authorize(ctx, userID, whatsappID); err != nil {
+		return err
+	}
+
+	s.streamsMu.Lock()
+	cancel, ok := s.streams[whatsappID]
+	s.streamsMu.Unlock()
+
+	if ok {
+		cancel(errStreamCancelled)
+	} else {
+		// Jumlah penerima 0 berarti tidak ada replica yang memegang stream
+		receivers, err := s.hub.PublishControl(ctx, whatsappID, streamControlCancel)
+		if err != nil {
+			return err
+		}
+		if receivers == 0 {
+			return ErrStreamNotRunning
+		}
+	}
+
+	s.logger.Infofctx(provider.AppLog, ctx, "Stream for whatsappID %s cancelled by user %s", whatsappID, userID)
+	return nil
+}
+
+// watchStreamControl menjalankan perintah dari channel kontrol whatsappID
+// untuk stream yang dipegang replica ini sampai ctx selesai. Channel
+// didengarkan lewat koneksi Pub/Sub bersama milik Hub.
+func (s *service) watchStreamControl(ctx context.Context, cancel context.CancelCauseFunc, whatsappID string) {
+	stop := s.hub.WatchControl(whatsappID, func(command string) {
+		if command == streamControlCancel {
+			s.logger.Infofctx(provider.AppLog, ctx, "Received cancel for whatsappID %s from another replica", whatsappID)
+			cancel(errStreamCancelled)
+		}
+	})
+	context.AfterFunc(ctx, stop)
+}
+
+// publishStreamCancelled memberi tahu viewer bahwa stream dihentikan pemilik akun
+func (s *service) publishStreamCancelled(ctx context.Context, whatsappID string) {
+	if err := s.hub.PublishMessage(ctx, whatsappID, model.WSMessage{
+		MsgStatus:  false,
+		Type:       "stream_cancelled",
+		WhatsappId: whatsappID,
+		Data:       errStreamCancelled.Error(),
+		Actions:    []string{model.WSCommandRestartQR},
+		Timestamp:  time.Now(),
+	}); err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error publishing stream_cancelled message: %v", err)
+	}
+}
+
+// publishStreamStopped memberi tahu viewer bahwa replica pemegang stream
+// berhenti dan lease sudah dilepas, sehingga restart_qr bisa dikirim
+func (s *service) publishStreamStopped(ctx context.Context, whatsappID string, cause error) {
+	if err := s.hub.PublishMessage(ctx, whatsappID, model.WSMessage{
+		MsgStatus:  false,
+		Type:       "stream_stopped",
+		WhatsappId: whatsappID,
+		Data:       cause.Error(),
+		Actions:    []string{model.WSCommandRestartQR},
+		Timestamp:  time.Now(),
+	}); err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error publishing stream_stopped message: %v", err)
+	}
+}
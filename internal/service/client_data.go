@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	proto "qrstreamer/model/pb"
+	"qrstreamer/util"
+	"strings"
+	"time"
+)
+
+const (
+	keyContactsPrefix = "contacts:%s"
+	keyGroupsPrefix   = "groups:%s"
+
+	defaultClientDataTTL = 30 * time.Second
+)
+
+func (g *gateway) GetContacts(ctx context.Context, senderJid string, query model.ClientDataQuery) (*model.ClientDataPage, error) {
+	items, err := g.cachedClientData(ctx, fmt.Sprintf(keyContactsPrefix, senderJid), func() ([]*proto.ClientdataItem, error) {
+		resp, err := g.app.GetClientContact(ctx, senderJid)
+		if err != nil {
+			g.logger.Errorfctx(provider.AppLog, ctx, false, "Error calling GetClientContact for %s: %v", senderJid, err)
+			return nil, err
+		}
+		return resp.GetContacts(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paginateClientData(items, query), nil
+}
+
+func (g *gateway) GetGroups(ctx context.Context, senderJid string, query model.ClientDataQuery) (*model.ClientDataPage, error) {
+	items, err := g.cachedClientData(ctx, fmt.Sprintf(keyGroupsPrefix, senderJid), func() ([]*proto.ClientdataItem, error) {
+		resp, err := g.app.GetClientGroup(ctx, senderJid)
+		if err != nil {
+			g.logger.Errorfctx(provider.AppLog, ctx, false, "Error calling GetClientGroup for %s: %v", senderJid, err)
+			return nil, err
+		}
+		return resp.GetGroups(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paginateClientData(items, query), nil
+}
+
+// cachedClientData membaca daftar kontak/grup dari Redis, atau memanggil fetch
+// lalu menyimpannya selama cache.client_data detik
+func (g *gateway) cachedClientData(ctx context.Context, key string, fetch func() ([]*proto.ClientdataItem, error)) ([]*proto.ClientdataItem, error) {
+	if cached, err := g.redis.Get(ctx, key).Bytes(); err == nil {
+		var items []*proto.ClientdataItem
+		if err := json.Unmarshal(cached, &items); err == nil {
+			return items, nil
+		}
+		g.logger.Errorfctx(provider.AppLog, ctx, false, "Error decoding cached %s, refetching", key)
+	}
+
+	items, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded, err := json.Marshal(items); err == nil {
+		ttl := util.ConfigSeconds(util.Configuration.Cache.ClientData, defaultClientDataTTL)
+		if err := g.redis.Set(ctx, key, encoded, ttl).Err(); err != nil {
+			g.logger.Errorfctx(provider.AppLog, ctx, false, "Error set %s in Redis: %v", key, err)
+		}
+	}
+	return items, nil
+}
+
+// paginateClientData memfilter item berdasarkan name/short lalu memotong sesuai halaman
+func paginateClientData(items []*proto.ClientdataItem, query model.ClientDataQuery) *model.ClientDataPage {
+	search := strings.ToLower(strings.TrimSpace(query.Search))
+
+	filtered := make([]*proto.ClientdataItem, 0, len(items))
+	for _, item := range items {
+		if search == "" ||
+			strings.Contains(strings.ToLower(item.GetName()), search) ||
+			strings.Contains(strings.ToLower(item.GetShort()), search) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	// Bandingkan nomor halaman dengan jumlah halaman agar page yang sangat besar tidak overflow
+	start := len(filtered)
+	if pages := (len(filtered) + query.PerPage - 1) / query.PerPage; query.Page-1 < pages {
+		start = (query.Page - 1) * query.PerPage
+	}
+	end := start + query.PerPage
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+
+	return &model.ClientDataPage{
+		Items:   filtered[start:end],
+		Page:    query.Page,
+		PerPage: query.PerPage,
+		Total:   len(filtered),
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"math"
+	"qrstreamer/model"
+	proto "qrstreamer/model/pb"
+	"testing"
+)
+
+func TestPaginateClientData(t *testing.T) {
+	items := []*proto.ClientdataItem{
+		{Jid: "1@s.whatsapp.net", Name: "Alice", Short: "Al"},
+		{Jid: "2@s.whatsapp.net", Name: "Bob", Short: "Bobby"},
+		{Jid: "3@s.whatsapp.net", Name: "Carol", Short: "Caz"},
+	}
+
+	tests := []struct {
+		name  string
+		query model.ClientDataQuery
+		want  []string
+		total int
+	}{
+		{"first page", model.ClientDataQuery{Page: 1, PerPage: 2}, []string{"1", "2"}, 3},
+		{"last partial page", model.ClientDataQuery{Page: 2, PerPage: 2}, []string{"3"}, 3},
+		{"past the end", model.ClientDataQuery{Page: 3, PerPage: 2}, nil, 3},
+		// (Page-1)*PerPage akan overflow jika tidak dibandingkan dengan jumlah halaman
+		{"page overflow", model.ClientDataQuery{Page: math.MaxInt, PerPage: 500}, nil, 3},
+		{"search by short", model.ClientDataQuery{Search: " bobby ", Page: 1, PerPage: 10}, []string{"2"}, 1},
+		{"search by name", model.ClientDataQuery{Search: "CAROL", Page: 1, PerPage: 10}, []string{"3"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := paginateClientData(items, tt.query)
+			if page.Total != tt.total {
+				t.Fatalf("total = %d, want %d", page.Total, tt.total)
+			}
+			if len(page.Items) != len(tt.want) {
+				t.Fatalf("got %d item(s), want %v", len(page.Items), tt.want)
+			}
+			for i, item := range page.Items {
+				if item.GetJid() != tt.want[i]+"@s.whatsapp.net" {
+					t.Fatalf("item %d = %s, want %s", i, item.GetJid(), tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"qrstreamer/internal/handler"
+	"qrstreamer/internal/provider"
+	"qrstreamer/internal/repository"
+	"qrstreamer/model"
+	proto "qrstreamer/model/pb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Gateway meneruskan request REST ke RPC wacore
+type Gateway interface {
+	GetDevices(ctx context.Context) ([]*proto.DeviceItem, error)
+	SendMessage(ctx context.Context, payload *proto.MessagePayload) (*proto.MessageResponse, error)
+	Send(ctx context.Context, req model.SendMessageRequest) (*model.SendMessageResult, error)
+	GetContacts(ctx context.Context, senderJid string, query model.ClientDataQuery) (*model.ClientDataPage, error)
+	GetGroups(ctx context.Context, senderJid string, query model.ClientDataQuery) (*model.ClientDataPage, error)
+	ListSentMessages(ctx context.Context, accountID string, filter model.OutboundFilter) ([]model.MessageOutbound, error)
+}
+
+type gateway struct {
+	logger    provider.ILogger
+	app       *handler.App
+	redis     *redis.Client
+	outbounds repository.OutboundRepository
+}
+
+func NewGateway(logger provider.ILogger, app *handler.App, redis *redis.Client, outbounds repository.OutboundRepository) Gateway {
+	return &gateway{
+		logger:    logger,
+		app:       app,
+		redis:     redis,
+		outbounds: outbounds,
+	}
+}
+
+func (g *gateway) GetDevices(ctx context.Context) ([]*proto.DeviceItem, error) {
+	resp, err := g.app.GetAllDevice(ctx)
+	if err != nil {
+		g.logger.Errorfctx(provider.AppLog, ctx, false, "Error calling GetAllDevice: %v", err)
+		return nil, err
+	}
+	return resp.GetDevices(), nil
+}
+
+func (g *gateway) SendMessage(ctx context.Context, payload *proto.MessagePayload) (*proto.MessageResponse, error) {
+	resp, err := g.app.SendMessage(ctx, payload)
+	if err != nil {
+		g.logger.Errorfctx(provider.AppLog, ctx, false, "Error calling SendMessage to %s: %v", payload.GetTo(), err)
+		return nil, err
+	}
+
+	g.logger.Infofctx(provider.AppLog, ctx, "Message %s sent from %s to %s", resp.GetId(), payload.GetSenderJid(), payload.GetTo())
+	return resp, nil
+}
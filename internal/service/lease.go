@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultStreamLeaseTTL = 60 * time.Second
+
+var errLeaseLost = errors.New("stream lease lost")
+
+// renewLeaseScript memperpanjang TTL lease hanya jika token masih milik replica ini
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript menghapus lease hanya jika token masih milik replica ini
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// streamLease adalah lock terdistribusi di Redis yang memastikan hanya satu
+// replica yang memegang stream upstream untuk satu whatsappID.
+type streamLease struct {
+	redis *redis.Client
+	key   string
+	token string
+	ttl   time.Duration
+}
+
+// acquireStreamLease mencoba mengambil lease secara atomik dengan SET NX.
+// Mengembalikan nil tanpa error jika lease sedang dipegang pihak lain.
+func acquireStreamLease(ctx context.Context, rdb *redis.Client, key string, ttl time.Duration) (*streamLease, error) {
+	if ttl <= 0 {
+		ttl = defaultStreamLeaseTTL
+	}
+
+	lease := &streamLease{
+		redis: rdb,
+		key:   key,
+		token: uuid.New().String(),
+		ttl:   ttl,
+	}
+
+	ok, err := rdb.SetNX(ctx, key, lease.token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return lease, nil
+}
+
+// renew memperpanjang lease. Mengembalikan errLeaseLost jika lease sudah
+// berpindah tangan atau kedaluwarsa.
+func (l *streamLease) renew(ctx context.Context) error {
+	n, err := renewLeaseScript.Run(ctx, l.redis, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// keepAlive memperbarui lease secara berkala sampai ctx selesai. onLost
+// dipanggil sekali jika lease tidak lagi dimiliki replica ini.
+func (l *streamLease) keepAlive(ctx context.Context, onLost func(error)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := l.renew(ctx)
+			if errors.Is(err, errLeaseLost) {
+				onLost(err)
+				return
+			}
+		}
+	}
+}
+
+// release menghapus lease jika masih dimiliki replica ini
+func (l *streamLease) release(ctx context.Context) error {
+	return releaseLeaseScript.Run(ctx, l.redis, []string{l.key}, l.token).Err()
+}
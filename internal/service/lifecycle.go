@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"qrstreamer/model/constant"
+	"time"
+)
+
+// Nilai connect_status_enum di whatsapp_accounts
+const (
+	connectStatusOnline  = "online"
+	connectStatusPairing = "pairing"
+	connectStatusOffline = "offline"
+)
+
+// recordLifecycle mencatat event pairing beserta IP dan User-Agent client yang
+// memulai stream, lalu memperbarui connect_status akun. Kegagalan hanya dilog
+// agar stream QR tetap berjalan.
+func (s *service) recordLifecycle(ctx context.Context, whatsappID string, eventType string, message string) {
+	now := time.Now()
+
+	ipAddress, _ := ctx.Value(constant.CtxClientIPKey).(string)
+	userAgent, _ := ctx.Value(constant.CtxUserAgentKey).(string)
+
+	event := &model.AccountEvent{
+		AccountID: whatsappID,
+		EventType: eventType,
+		Message:   message,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Timestamp: now,
+	}
+	if err := s.events.Record(ctx, event); err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error recording %s event for %s: %v", eventType, whatsappID, err)
+	}
+
+	var (
+		status      string
+		lastQRAt    *time.Time
+		connectedAt *time.Time
+	)
+	switch eventType {
+	case model.AccountEventQRIssued:
+		status, lastQRAt = connectStatusPairing, &now
+	case model.AccountEventPaired:
+		status, connectedAt = connectStatusOnline, &now
+	case model.AccountEventQRTimeout, model.AccountEventFailed, model.AccountEventLoggedOut, model.AccountEventDisconnected:
+		status = connectStatusOffline
+	default:
+		return
+	}
+
+	if err := s.accounts.UpdateConnectStatus(ctx, whatsappID, status, lastQRAt, connectedAt); err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error updating connect_status of %s: %v", whatsappID, err)
+		return
+	}
+	s.invalidateAccount(ctx, whatsappID)
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	proto "qrstreamer/model/pb"
+)
+
+// ErrInvalidMessage dikembalikan saat payload pesan tidak valid sebelum dikirim ke wacore
+var ErrInvalidMessage = errors.New("invalid message")
+
+// Send memvalidasi request pesan, memetakannya ke MessagePayload lalu
+// mengirimnya lewat SendMessage. Mengembalikan ID pesan dari wacore.
+func (g *gateway) Send(ctx context.Context, req model.SendMessageRequest) (*model.SendMessageResult, error) {
+	payload, err := buildMessagePayload(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.SendMessage(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pesan sudah terkirim, kegagalan pencatatan hanya dilog
+	g.recordOutbound(ctx, req, resp.GetId())
+
+	return &model.SendMessageResult{ID: resp.GetId()}, nil
+}
+
+// ListSentMessages mengembalikan pesan keluar akun untuk keperluan audit
+func (g *gateway) ListSentMessages(ctx context.Context, accountID string, filter model.OutboundFilter) ([]model.MessageOutbound, error) {
+	return g.outbounds.ListByAccount(ctx, accountID, filter)
+}
+
+// recordOutbound menyimpan pesan yang berhasil dikirim ke message_outbounds
+func (g *gateway) recordOutbound(ctx context.Context, req model.SendMessageRequest, messageID string) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		g.logger.Errorfctx(provider.AppLog, ctx, false, "Error encoding outbound message %s: %v", messageID, err)
+		return
+	}
+
+	outbound := &model.MessageOutbound{
+		MessageID:   messageID,
+		Recipient:   req.To,
+		MessageType: req.Type,
+		Data:        data,
+	}
+	if err := g.outbounds.CreateBySenderJid(ctx, req.SenderJid, outbound); err != nil {
+		g.logger.Errorfctx(provider.AppLog, ctx, false, "Error recording outbound message %s: %v", messageID, err)
+		return
+	}
+	g.logger.Debugfctx(provider.AppLog, ctx, "Outbound message %s recorded as %s", messageID, outbound.OutboundID)
+}
+
+// buildMessagePayload memetakan request ke proto.MessagePayload sesuai Type
+func buildMessagePayload(req model.SendMessageRequest) (*proto.MessagePayload, error) {
+	if req.SenderJid == "" {
+		return nil, invalidMessage("sender_jid is required")
+	}
+	if req.To == "" {
+		return nil, invalidMessage("to is required")
+	}
+
+	payload := &proto.MessagePayload{
+		SenderJid: req.SenderJid,
+		To:        req.To,
+		Type:      req.Type,
+	}
+
+	switch req.Type {
+	case "text":
+		if req.Text == "" {
+			return nil, invalidMessage("text is required")
+		}
+		payload.Text = req.Text
+
+	case "image", "video":
+		media := req.Image
+		if req.Type == "video" {
+			media = req.Video
+		}
+		if media == nil {
+			return nil, invalidMessage("%s is required", req.Type)
+		}
+		if err := validateURL(req.Type+".url", media.URL); err != nil {
+			return nil, err
+		}
+		pbMedia := &proto.Media{Url: media.URL, Caption: media.Caption, Mimetype: media.Mimetype}
+		if req.Type == "image" {
+			payload.Image = pbMedia
+		} else {
+			payload.Video = pbMedia
+		}
+
+	case "audio":
+		if req.Audio == nil {
+			return nil, invalidMessage("audio is required")
+		}
+		if err := validateURL("audio.url", req.Audio.URL); err != nil {
+			return nil, err
+		}
+		payload.Audio = &proto.Audio{Url: req.Audio.URL, MimeType: req.Audio.MimeType, Ptt: req.Audio.PTT}
+
+	case "document":
+		if req.Document == nil {
+			return nil, invalidMessage("document is required")
+		}
+		if err := validateURL("document.url", req.Document.URL); err != nil {
+			return nil, err
+		}
+		payload.Document = &proto.Document{
+			Url:      req.Document.URL,
+			Filename: req.Document.Filename,
+			Mimetype: req.Document.Mimetype,
+			Title:    req.Document.Title,
+		}
+
+	case "location":
+		if req.Location == nil {
+			return nil, invalidMessage("location is required")
+		}
+		if err := validateCoordinates("location", req.Location.Latitude, req.Location.Longitude); err != nil {
+			return nil, err
+		}
+		payload.Location = &proto.Location{
+			Latitude:  *req.Location.Latitude,
+			Longitude: *req.Location.Longitude,
+			Name:      req.Location.Name,
+			Address:   req.Location.Address,
+		}
+
+	case "vcard":
+		if req.Vcard == nil {
+			return nil, invalidMessage("vcard is required")
+		}
+		if err := validateContact("vcard", *req.Vcard); err != nil {
+			return nil, err
+		}
+		payload.Vcard = &proto.Contact{Name: req.Vcard.Name, Phone: req.Vcard.Phone}
+
+	case "contacts":
+		if len(req.Contacts) == 0 {
+			return nil, invalidMessage("contacts must not be empty")
+		}
+		list := make([]*proto.Contact, 0, len(req.Contacts))
+		for i, contact := range req.Contacts {
+			if err := validateContact(fmt.Sprintf("contacts[%d]", i), contact); err != nil {
+				return nil, err
+			}
+			list = append(list, &proto.Contact{Name: contact.Name, Phone: contact.Phone})
+		}
+		payload.Contacts = &proto.Contacts{List: list}
+
+	case "live_location":
+		if req.LiveLocation == nil {
+			return nil, invalidMessage("live_location is required")
+		}
+		if err := validateCoordinates("live_location", req.LiveLocation.Latitude, req.LiveLocation.Longitude); err != nil {
+			return nil, err
+		}
+		payload.LiveLocation = &proto.LiveLocation{
+			Latitude:  *req.LiveLocation.Latitude,
+			Longitude: *req.LiveLocation.Longitude,
+			Duration:  req.LiveLocation.Duration,
+		}
+
+	case "":
+		return nil, invalidMessage("type is required")
+	default:
+		return nil, invalidMessage("unsupported type %q", req.Type)
+	}
+
+	return payload, nil
+}
+
+func invalidMessage(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMessage, fmt.Sprintf(format, args...))
+}
+
+func validateURL(field, value string) error {
+	if value == "" {
+		return invalidMessage("%s is required", field)
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidMessage("%s must be an absolute http(s) URL", field)
+	}
+	return nil
+}
+
+// validateCoordinates menolak koordinat yang tidak dikirim, karena 0 adalah
+// koordinat yang valid dan tidak bisa dibedakan dari field kosong
+func validateCoordinates(field string, lat, long *float64) error {
+	if lat == nil {
+		return invalidMessage("%s.latitude is required", field)
+	}
+	if long == nil {
+		return invalidMessage("%s.longitude is required", field)
+	}
+	if math.IsNaN(*lat) || *lat < -90 || *lat > 90 {
+		return invalidMessage("%s.latitude must be between -90 and 90", field)
+	}
+	if math.IsNaN(*long) || *long < -180 || *long > 180 {
+		return invalidMessage("%s.longitude must be between -180 and 180", field)
+	}
+	return nil
+}
+
+func validateContact(field string, contact model.ContactPayload) error {
+	if contact.Name == "" {
+		return invalidMessage("%s.name is required", field)
+	}
+	if contact.Phone == "" {
+		return invalidMessage("%s.phone is required", field)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"qrstreamer/model"
+	"testing"
+)
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+func TestValidateCoordinates(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, long *float64
+		ok        bool
+	}{
+		{"origin is valid", ptr(0), ptr(0), true},
+		{"bounds are valid", ptr(-90), ptr(180), true},
+		{"missing latitude", nil, ptr(106.8), false},
+		{"missing longitude", ptr(-6.2), nil, false},
+		{"latitude out of range", ptr(90.1), ptr(0), false},
+		{"longitude out of range", ptr(0), ptr(-180.5), false},
+		{"latitude NaN", ptr(math.NaN()), ptr(0), false},
+		{"longitude NaN", ptr(0), ptr(math.NaN()), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoordinates("location", tt.lat, tt.long)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidMessage) {
+				t.Fatalf("error = %v, want ErrInvalidMessage", err)
+			}
+		})
+	}
+}
+
+func TestBuildMessagePayload(t *testing.T) {
+	base := model.SendMessageRequest{SenderJid: "628111@s.whatsapp.net", To: "628222@s.whatsapp.net"}
+	with := func(modify func(*model.SendMessageRequest)) model.SendMessageRequest {
+		req := base
+		modify(&req)
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  model.SendMessageRequest
+		ok   bool
+	}{
+		{"text", with(func(r *model.SendMessageRequest) { r.Type, r.Text = "text", "hi" }), true},
+		{"empty text", with(func(r *model.SendMessageRequest) { r.Type = "text" }), false},
+		{"missing sender", with(func(r *model.SendMessageRequest) { r.SenderJid, r.Type, r.Text = "", "text", "hi" }), false},
+		{"missing type", base, false},
+		{"unsupported type", with(func(r *model.SendMessageRequest) { r.Type = "sticker" }), false},
+		{"image", with(func(r *model.SendMessageRequest) {
+			r.Type, r.Image = "image", &model.MediaPayload{URL: "https://example.com/a.png"}
+		}), true},
+		{"image with relative url", with(func(r *model.SendMessageRequest) {
+			r.Type, r.Image = "image", &model.MediaPayload{URL: "/a.png"}
+		}), false},
+		{"location at origin", with(func(r *model.SendMessageRequest) {
+			r.Type, r.Location = "location", &model.LocationPayload{Latitude: ptr(0), Longitude: ptr(0)}
+		}), true},
+		{"location without longitude", with(func(r *model.SendMessageRequest) {
+			r.Type, r.Location = "location", &model.LocationPayload{Latitude: ptr(1)}
+		}), false},
+		{"live location out of range", with(func(r *model.SendMessageRequest) {
+			r.Type, r.LiveLocation = "live_location", &model.LiveLocationPayload{Latitude: ptr(91), Longitude: ptr(0)}
+		}), false},
+		{"contacts with missing phone", with(func(r *model.SendMessageRequest) {
+			r.Type, r.Contacts = "contacts", []model.ContactPayload{{Name: "A", Phone: "1"}, {Name: "B"}}
+		}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := buildMessagePayload(tt.req)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidMessage) {
+					t.Fatalf("error = %v, want ErrInvalidMessage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if payload.GetType() != tt.req.Type || payload.GetSenderJid() != tt.req.SenderJid {
+				t.Fatalf("payload = %v, want type %s from %s", payload, tt.req.Type, tt.req.SenderJid)
+			}
+		})
+	}
+}
+
+func TestBuildMessagePayloadKeepsZeroCoordinates(t *testing.T) {
+	payload, err := buildMessagePayload(model.SendMessageRequest{
+		SenderJid: "628111@s.whatsapp.net",
+		To:        "628222@s.whatsapp.net",
+		Type:      "location",
+		Location:  &model.LocationPayload{Latitude: ptr(0), Longitude: ptr(-0.5), Name: "Null Island"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	location := payload.GetLocation()
+	if location.GetLatitude() != 0 || location.GetLongitude() != -0.5 || location.GetName() != "Null Island" {
+		t.Fatalf("location = %v", location)
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyPairStatePrefix = "pairstate:%s"
+
+	pairStateTTL = 24 * time.Hour
+)
+
+// ErrIllegalTransition dikembalikan saat event tidak berlaku untuk state saat ini
+var ErrIllegalTransition = errors.New("illegal pairing transition")
+
+// pairingEvents adalah event yang boleh dikirim wacore lewat Desc. qr_issued
+// tidak termasuk karena berasal dari frame bertipe "qr".
+var pairingEvents = map[string]bool{
+	model.AccountEventQRScanned:    true,
+	model.AccountEventPaired:       true,
+	model.AccountEventQRTimeout:    true,
+	model.AccountEventFailed:       true,
+	model.AccountEventLoggedOut:    true,
+	model.AccountEventDisconnected: true,
+}
+
+// pairingTransitions adalah transisi yang sah: state -> event -> state berikutnya
+var pairingTransitions = map[string]map[string]string{
+	model.PairingIdle: {
+		model.AccountEventQRIssued:     model.PairingAwaitingScan,
+		model.AccountEventPaired:       model.PairingPaired,
+		model.AccountEventFailed:       model.PairingFailed,
+		model.AccountEventLoggedOut:    model.PairingLoggedOut,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+	model.PairingAwaitingScan: {
+		model.AccountEventQRIssued:     model.PairingAwaitingScan,
+		model.AccountEventQRScanned:    model.PairingScanned,
+		model.AccountEventPaired:       model.PairingPaired,
+		model.AccountEventQRTimeout:    model.PairingExpired,
+		model.AccountEventFailed:       model.PairingFailed,
+		model.AccountEventLoggedOut:    model.PairingLoggedOut,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+	model.PairingScanned: {
+		// Scan yang tidak diselesaikan membuat wacore mengirim QR baru
+		model.AccountEventQRIssued:     model.PairingAwaitingScan,
+		model.AccountEventPaired:       model.PairingPaired,
+		model.AccountEventQRTimeout:    model.PairingExpired,
+		model.AccountEventFailed:       model.PairingFailed,
+		model.AccountEventLoggedOut:    model.PairingLoggedOut,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+	model.PairingPaired: {
+		model.AccountEventLoggedOut:    model.PairingLoggedOut,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+	model.PairingExpired: {
+		model.AccountEventQRIssued:     model.PairingAwaitingScan,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+	model.PairingFailed: {
+		model.AccountEventQRIssued:     model.PairingAwaitingScan,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+	model.PairingLoggedOut: {
+		model.AccountEventQRIssued:     model.PairingAwaitingScan,
+		model.AccountEventDisconnected: model.PairingIdle,
+	},
+}
+
+// parsePairingDesc mengubah deskripsi wacore menjadi event pairing. Deskripsi
+// dipetakan lewat upstream.pairing_descs; deskripsi yang sama dengan nama event
+// diterima apa adanya.
+func parsePairingDesc(desc string) (string, bool) {
+	key := strings.ToLower(desc)
+	// Viper menyimpan key map dalam huruf kecil
+	if event, ok := util.Configuration.Upstream.PairingDescs[key]; ok && pairingEvents[event] {
+		return event, true
+	}
+	if pairingEvents[key] {
+		return key, true
+	}
+	return "", false
+}
+
+// pairingMachine menyimpan state pairing satu stream upstream
+type pairingMachine struct {
+	whatsappID string
+	state      string
+}
+
+func newPairingMachine(whatsappID string) *pairingMachine {
+	return &pairingMachine{
+		whatsappID: whatsappID,
+		state:      model.PairingIdle,
+	}
+}
+
+// apply menjalankan event dan mengembalikan state baru, atau ErrIllegalTransition
+func (m *pairingMachine) apply(event string) (string, error) {
+	next, ok := pairingTransitions[m.state][event]
+	if !ok {
+		return m.state, fmt.Errorf("%w: %s on %s for %s", ErrIllegalTransition, event, m.state, m.whatsappID)
+	}
+	m.state = next
+	return next, nil
+}
+
+// applyPairingEvent menjalankan transisi, lalu mencatat siklus pairing dan
+// menyimpan state baru. Transisi ilegal hanya dilog dan frame diabaikan.
+func (s *service) applyPairingEvent(ctx context.Context, machine *pairingMachine, event string, desc string) (string, error) {
+	state, err := machine.apply(event)
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Rejecting wacore frame: %v", err)
+		return state, err
+	}
+
+	s.recordLifecycle(ctx, machine.whatsappID, event, desc)
+	s.savePairingState(ctx, model.PairingStatus{
+		WhatsappId: machine.whatsappID,
+		State:      state,
+		Event:      event,
+		Desc:       desc,
+		UpdatedAt:  time.Now(),
+	})
+	return state, nil
+}
+
+// savePairingState menyimpan state terakhir ke Redis agar bisa dibaca replica mana pun
+func (s *service) savePairingState(ctx context.Context, status model.PairingStatus) {
+	encoded, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if err := s.redis.Set(ctx, fmt.Sprintf(keyPairStatePrefix, status.WhatsappId), encoded, pairStateTTL).Err(); err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error set pairing state in Redis: %v", err)
+	}
+}
+
+// GetPairingState mengembalikan state pairing terakhir akun milik userID.
+// Akun yang belum pernah distream dianggap idle.
+func (s *service) GetPairingState(ctx context.Context, userID string, whatsappID string) (*model.PairingStatus, error) {
+	if err := s.Authorize(ctx, userID, whatsappID); err != nil {
+		return nil, err
+	}
+
+	encoded, err := s.redis.Get(ctx, fmt.Sprintf(keyPairStatePrefix, whatsappID)).Bytes()
+	if err == redis.Nil {
+		return &model.PairingStatus{WhatsappId: whatsappID, State: model.PairingIdle}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var status model.PairingStatus
+	if err := json.Unmarshal(encoded, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"testing"
+)
+
+func TestPairingTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  string
+		event string
+		want  string
+		err   error
+	}{
+		{"qr issued from idle", model.PairingIdle, model.AccountEventQRIssued, model.PairingAwaitingScan, nil},
+		{"qr rotated while awaiting scan", model.PairingAwaitingScan, model.AccountEventQRIssued, model.PairingAwaitingScan, nil},
+		{"qr scanned", model.PairingAwaitingScan, model.AccountEventQRScanned, model.PairingScanned, nil},
+		{"qr reissued after abandoned scan", model.PairingScanned, model.AccountEventQRIssued, model.PairingAwaitingScan, nil},
+		{"paired after scan", model.PairingScanned, model.AccountEventPaired, model.PairingPaired, nil},
+		{"timeout after scan", model.PairingScanned, model.AccountEventQRTimeout, model.PairingExpired, nil},
+		{"disconnect resets scanned", model.PairingScanned, model.AccountEventDisconnected, model.PairingIdle, nil},
+		{"disconnect resets paired", model.PairingPaired, model.AccountEventDisconnected, model.PairingIdle, nil},
+		{"new qr after expiry", model.PairingExpired, model.AccountEventQRIssued, model.PairingAwaitingScan, nil},
+		{"new qr after logout", model.PairingLoggedOut, model.AccountEventQRIssued, model.PairingAwaitingScan, nil},
+		{"scan without qr", model.PairingIdle, model.AccountEventQRScanned, model.PairingIdle, ErrIllegalTransition},
+		{"qr after paired", model.PairingPaired, model.AccountEventQRIssued, model.PairingPaired, ErrIllegalTransition},
+		{"scan after expiry", model.PairingExpired, model.AccountEventQRScanned, model.PairingExpired, ErrIllegalTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &pairingMachine{whatsappID: "wa-1", state: tt.from}
+			got, err := machine.apply(tt.event)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("apply(%s) error = %v, want %v", tt.event, err, tt.err)
+			}
+			if got != tt.want || machine.state != tt.want {
+				t.Fatalf("apply(%s) = %s (machine %s), want %s", tt.event, got, machine.state, tt.want)
+			}
+		})
+	}
+}
+
+// Setelah reconnect di state scanned, QR dari stream baru harus tetap diterima
+func TestPairingReconnectFromScanned(t *testing.T) {
+	machine := newPairingMachine("wa-1")
+	for _, event := range []string{model.AccountEventQRIssued, model.AccountEventQRScanned, model.AccountEventDisconnected} {
+		if _, err := machine.apply(event); err != nil {
+			t.Fatalf("apply(%s): %v", event, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if state, err := machine.apply(model.AccountEventQRIssued); err != nil || state != model.PairingAwaitingScan {
+			t.Fatalf("qr %d after reconnect = %s, %v", i, state, err)
+		}
+	}
+}
+
+func TestParsePairingDesc(t *testing.T) {
+	saved := util.Configuration.Upstream.PairingDescs
+	t.Cleanup(func() { util.Configuration.Upstream.PairingDescs = saved })
+	util.Configuration.Upstream.PairingDescs = map[string]string{
+		"pairsuccess": model.AccountEventPaired,
+		"bogus":       "not_an_event",
+	}
+
+	tests := []struct {
+		desc  string
+		want  string
+		known bool
+	}{
+		{"PairSuccess", model.AccountEventPaired, true},
+		{"qr_scanned", model.AccountEventQRScanned, true},
+		{"LOGGED_OUT", model.AccountEventLoggedOut, true},
+		{"qr_issued", "", false},
+		{"bogus", "", false},
+		{"something else", "", false},
+	}
+	for _, tt := range tests {
+		got, known := parsePairingDesc(tt.desc)
+		if got != tt.want || known != tt.known {
+			t.Errorf("parsePairingDesc(%q) = %q, %v; want %q, %v", tt.desc, got, known, tt.want, tt.known)
+		}
+	}
+}
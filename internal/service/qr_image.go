@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"qrstreamer/internal/provider"
+	"qrstreamer/util"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultQRWait          = 10 * time.Second
+	defaultQRStreamTimeout = 60 * time.Second
+	qrPollInterval         = 250 * time.Millisecond
+)
+
+// GetCurrentQR mengembalikan QR terakhir dari cache "qr:<whatsappID>" beserta
+// sisa umurnya. Jika belum ada QR, stream upstream dijalankan di background
+// lalu ditunggu sampai QR pertama tersedia atau batas qr_image.wait habis.
+func (s *service) GetCurrentQR(ctx context.Context, userID string, whatsappID string) (string, time.Duration, error) {
+	if err := s.Authorize(ctx, userID, whatsappID); err != nil {
+		return "", 0, err
+	}
+
+	if qrCode, ttl, err := s.cachedQR(ctx, whatsappID); err != redis.Nil {
+		return qrCode, ttl, err
+	}
+
+	if err := s.checkAccount(ctx, userID, whatsappID); err != nil {
+		return "", 0, err
+	}
+
+	// Stream tanpa viewer WebSocket, umurnya dibatasi qr_image.stream_timeout
+	streamTimeout := util.ConfigSeconds(util.Configuration.QRImage.StreamTimeout, defaultQRStreamTimeout)
+	go func() {
+		streamCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), streamTimeout)
+		defer cancel()
+
+		if err := s.streamQR(streamCtx, userID, whatsappID, false); err != nil {
+			s.logger.Errorfctx(provider.AppLog, streamCtx, false, "Error streaming QR for image request: %v", err)
+		}
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, util.ConfigSeconds(util.Configuration.QRImage.Wait, defaultQRWait))
+	defer cancel()
+
+	ticker := time.NewTicker(qrPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-waitCtx.Done():
+			return "", 0, fmt.Errorf("%w: no QR for whatsappID %s", ErrQRNotReady, whatsappID)
+		case <-ticker.C:
+			qrCode, ttl, err := s.cachedQR(waitCtx, whatsappID)
+			if err == redis.Nil {
+				continue
+			}
+			return qrCode, ttl, err
+		}
+	}
+}
+
+// cachedQR membaca QR dan TTL dari cache "qr:<whatsappID>"
+func (s *service) cachedQR(ctx context.Context, whatsappID string) (string, time.Duration, error) {
+	qrKey := fmt.Sprintf(keyQrPrefix, whatsappID)
+
+	qrCode, err := s.redis.Get(ctx, qrKey).Result()
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl, err := s.redis.TTL(ctx, qrKey).Result()
+	if err != nil {
+		return "", 0, err
+	}
+	return qrCode, ttl, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"qrstreamer/internal/handler"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	proto "qrstreamer/model/pb"
+	"qrstreamer/util"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultReconnectBaseDelay   = 500 * time.Millisecond
+	defaultReconnectMaxDelay    = 10 * time.Second
+	defaultReconnectMaxAttempts = 5
+)
+
+var errReconnectExhausted = errors.New("upstream reconnect attempts exhausted")
+
+// isTransientStreamError menentukan apakah error Recv layak dicoba ulang
+func isTransientStreamError(err error) bool {
+	if errors.Is(err, handler.ErrGRPCNotConnected) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// reconnectBackoff menghitung jeda exponential dengan jitter untuk percobaan ke-attempt
+func reconnectBackoff(attempt int) time.Duration {
+	cfg := util.Configuration.Upstream
+
+	base := time.Duration(cfg.ReconnectBaseDelayMs) * time.Millisecond
+	if base <= 0 {
+		base = defaultReconnectBaseDelay
+	}
+	maxDelay := time.Duration(cfg.ReconnectMaxDelayMs) * time.Millisecond
+	if maxDelay <= 0 {
+		maxDelay = defaultReconnectMaxDelay
+	}
+
+	delay := base << (attempt - 1)
+	if delay > maxDelay || delay <= 0 {
+		delay = maxDelay
+	}
+
+	// Jitter: jeda acak antara setengah dan penuh agar replica tidak reconnect bersamaan
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// connectStream membuka StreamConnectDevice. Error transient dicoba ulang
+// dengan jeda backoff sampai batas reconnect_max_attempts. attempt adalah
+// jumlah percobaan gagal sejak frame terakhir yang berhasil diterima, nilai
+// terbarunya dikembalikan agar caller menghitung semua percobaan.
+func (s *service) connectStream(ctx context.Context, req *proto.ConnectDeviceRequest, attempt int) (proto.WaCoreGateway_StreamConnectDeviceClient, int, error) {
+	maxAttempts := util.Configuration.Upstream.ReconnectMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultReconnectMaxAttempts
+	}
+
+	for {
+		if attempt > 0 {
+			if attempt > maxAttempts {
+				return nil, attempt, fmt.Errorf("%w after %d attempt(s)", errReconnectExhausted, maxAttempts)
+			}
+
+			delay := reconnectBackoff(attempt)
+			s.logger.Infofctx(provider.AppLog, ctx, "Reconnecting stream for whatsappID %s in %s (attempt %d/%d)", req.Name, delay, attempt, maxAttempts)
+			s.publishStatus(ctx, req.Name, "reconnecting", true, fmt.Sprintf("Reconnecting to upstream (attempt %d/%d)", attempt, maxAttempts))
+
+			select {
+			case <-ctx.Done():
+				return nil, attempt, context.Cause(ctx)
+			case <-time.After(delay):
+			}
+		}
+
+		stream, err := s.app.StreamConnectDevice(ctx, req)
+		if err == nil {
+			return stream, attempt, nil
+		}
+		if !isTransientStreamError(err) {
+			return nil, attempt, err
+		}
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error connecting stream for whatsappID %s: %v", req.Name, err)
+		attempt++
+	}
+}
+
+// publishStatus mengirim pesan status stream ke semua viewer whatsappID
+func (s *service) publishStatus(ctx context.Context, whatsappID string, msgType string, ok bool, data string) {
+	err := s.hub.PublishMessage(ctx, whatsappID, model.WSMessage{
+		MsgStatus:  ok,
+		Type:       msgType,
+		WhatsappId: whatsappID,
+		Data:       data,
+		Timestamp:  time.Now(),
+	})
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error publishing %s message: %v", msgType, err)
+	}
+}
@@ -2,13 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"qrstreamer/internal/handler"
 	"qrstreamer/internal/provider"
+	"qrstreamer/internal/repository"
 	"qrstreamer/model"
 	"qrstreamer/util"
+	"sync"
 	"time"
 
 	proto "qrstreamer/model/pb"
@@ -21,134 +24,381 @@ const (
 	keyWaStreamPrefix = "wsstream:%s"
 	waaKeyPrefix      = "waa:%s"
 	keyQrPrefix       = "qr:%s"
+
+	// streamControlCancel adalah perintah kontrol untuk menghentikan stream di replica pemegangnya
+	streamControlCancel = "cancel"
+)
+
+// defaultQRSpan dipakai jika redis.qr_span tidak diset, sesuai jendela rotasi QR WhatsApp
+const defaultQRSpan = 20 * time.Second
+
+// viewerCheckInterval adalah jeda pemeriksaan viewer di replica lain setelah viewer lokal habis
+const viewerCheckInterval = 5 * time.Second
+
+var (
+	// ErrAccountNotFound dikembalikan saat whatsappID tidak terdaftar
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrQRNotReady dikembalikan saat QR belum tersedia dalam batas waktu tunggu
+	ErrQRNotReady = errors.New("qr code not ready")
+
+	// ErrStreamNotRunning dikembalikan CancelStream saat tidak ada stream untuk whatsappID
+	ErrStreamNotRunning = errors.New("stream is not running")
+
+	errNoViewers       = errors.New("no viewers left")
+	errStreamCancelled = errors.New("stream cancelled by client")
+	errServerShutdown  = errors.New("server shutting down")
 )
 
 type QRStreamer interface {
 	StreamWhatsappQR(ctx context.Context, userID string, whatsappID string) error
+	GetCurrentQR(ctx context.Context, userID string, whatsappID string) (string, time.Duration, error)
+	Authorize(ctx context.Context, userID string, whatsappID string) error
+	AuthorizeSender(ctx context.Context, userID string, senderJid string) error
+	OwnDevices(ctx context.Context, userID string, devices []*proto.DeviceItem) ([]*proto.DeviceItem, error)
+	GetPairingState(ctx context.Context, userID string, whatsappID string) (*model.PairingStatus, error)
+	CancelStream(ctx context.Context, userID string, whatsappID string) error
+	Shutdown(ctx context.Context) error
 }
 type service struct {
-	logger provider.ILogger
-	hub    *handler.Hub
-	app    *handler.App
-	redis  *redis.Client
+	logger   provider.ILogger
+	hub      *handler.Hub
+	app      *handler.App
+	redis    *redis.Client
+	accounts repository.AccountRepository
+	events   repository.AccountEventRepository
+
+	// streams adalah cancel stream upstream yang dipegang replica ini, per whatsappID
+	streams   map[string]context.CancelCauseFunc
+	streamsMu sync.Mutex
+	// running menunggu semua streamQR selesai, closing menolak stream baru saat shutdown
+	running sync.WaitGroup
+	closing bool
 }
 
-func NewService(logger provider.ILogger, hub *handler.Hub, app *handler.App, redis *redis.Client) QRStreamer {
+func NewService(logger provider.ILogger, hub *handler.Hub, app *handler.App, redis *redis.Client, accounts repository.AccountRepository, events repository.AccountEventRepository) QRStreamer {
 	return &service{
-		logger: logger,
-		hub:    hub,
-		app:    app,
-		redis:  redis,
+		logger:   logger,
+		hub:      hub,
+		app:      app,
+		redis:    redis,
+		accounts: accounts,
+		events:   events,
+		streams:  make(map[string]context.CancelCauseFunc),
 	}
 }
 
 func (s *service) StreamWhatsappQR(ctx context.Context, userID string, whatsappID string) error {
-	// Cek apakah stream untuk whatsappID sudah aktif
-	streamKey := fmt.Sprintf(keyWaStreamPrefix, whatsappID)
-
-	activeStream, err := s.redis.Get(ctx, streamKey).Bool()
-	if err == nil && activeStream {
-		s.logger.Infofctx(provider.AppLog, ctx, "Stream for whatsappID %s is already running", whatsappID)
+	return s.streamQR(ctx, userID, whatsappID, true)
+}
 
-		qrKey := fmt.Sprintf(keyQrPrefix, whatsappID)
-		if qrCode, err := s.redis.Get(ctx, qrKey).Result(); err == nil {
-			message := model.WSMessage{
-				MsgStatus:  true,
-				Type:       "qr_code",
-				WhatsappId: whatsappID,
-				Data:       qrCode,
-				Timestamp:  time.Now(),
-			}
+// streamQR menjalankan stream upstream untuk whatsappID. Jika watchViewers true,
+// stream dibatalkan saat viewer terakhir keluar; jika false, umur stream
+// ditentukan oleh ctx.
+func (s *service) streamQR(ctx context.Context, userID string, whatsappID string, watchViewers bool) error {
+	if !s.beginStream() {
+		return errServerShutdown
+	}
+	defer s.running.Done()
 
-			if err := s.hub.EmitMessageToClient(ctx, whatsappID, message); err != nil {
-				s.logger.Errorfctx(provider.AppLog, ctx, false, "Error emitting QR code: %v", err)
-			}
-		}
+	// Ambil lease stream secara atomik, hanya satu replica yang boleh memegang stream upstream
+	streamKey := fmt.Sprintf(keyWaStreamPrefix, whatsappID)
 
+	lease, err := acquireStreamLease(ctx, s.redis, streamKey, time.Duration(util.Configuration.Cache.WSStream)*time.Second)
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error acquire stream lease in Redis: %v", err)
+		return err
+	}
+	if lease == nil {
+		// Viewer yang bergabung belakangan sudah menerima QR terakhir dari
+		// replay buffer saat terdaftar di Hub, sisanya mengikuti pesan live
+		s.logger.Infofctx(provider.AppLog, ctx, "Stream for whatsappID %s is already running", whatsappID)
 		return nil
 	}
 
-	// Tandai stream aktif di Redis dengan TTL 1 menit
-	err = s.redis.Set(ctx, streamKey, true, time.Duration(util.Configuration.Cache.WSStream)*time.Second).Err()
-	if err != nil {
-		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error set stream status in Redis: %v", err)
-	}
+	// stopCause adalah penyebab stream berhenti. Pesan penutup baru dikirim
+	// setelah lease dilepas agar restart_qr dari viewer bisa langsung mengambil lease.
+	var stopCause error
+	// expiredState adalah state pairing saat session dihentikan batas session
+	var expiredState string
+	defer func() {
+		switch {
+		case isSessionLimit(stopCause):
+			s.publishSessionExpired(context.WithoutCancel(ctx), whatsappID, expiredState, stopCause)
+		case errors.Is(stopCause, errStreamCancelled):
+			s.publishStreamCancelled(context.WithoutCancel(ctx), whatsappID)
+		case errors.Is(stopCause, errServerShutdown):
+			// Viewer di replica lain bisa memulai ulang stream di replica mereka
+			s.publishStreamStopped(context.WithoutCancel(ctx), whatsappID, stopCause)
+		}
+	}()
 
 	defer func() {
 		// Close client connection
 		//s.hub.CloseClientConnection(whatsappID)
 
-		delErr := s.redis.Del(ctx, streamKey).Err()
-		if delErr != nil {
-			s.logger.Errorfctx(provider.AppLog, ctx, false, "Error delete stream status in Redis: %v", delErr)
+		relErr := lease.release(context.WithoutCancel(ctx))
+		if relErr != nil {
+			s.logger.Errorfctx(provider.AppLog, ctx, false, "Error release stream lease in Redis: %v", relErr)
 		}
 	}()
 
-	// "waa:<whatsappID>"
-	redisKey := fmt.Sprintf(waaKeyPrefix, whatsappID)
-	_, err = s.redis.Get(ctx, redisKey).Result()
-	if err != nil {
-		if err == redis.Nil {
-			s.logger.Errorfctx(provider.AppLog, ctx, false, "WhatsappID %s not found in Redis", whatsappID)
-			s.hub.EmitMessageToClient(ctx, whatsappID, model.WSMessage{
+	if err := s.checkAccount(ctx, userID, whatsappID); err != nil {
+		// Jangan kirim forbidden ke channel akun, viewer lain adalah pemilik yang sah
+		if errors.Is(err, ErrForbidden) {
+			return err
+		}
+		if errors.Is(err, ErrAccountNotFound) || errors.Is(err, ErrAccountInactive) || errors.Is(err, ErrAccountOnline) {
+			s.hub.PublishMessage(ctx, whatsappID, model.WSMessage{
 				MsgStatus:  false,
 				Type:       "error",
 				WhatsappId: whatsappID,
-				Data:       fmt.Errorf("WhatsappID %s not found in Redis", whatsappID).Error(),
+				Data:       err.Error(),
 				Timestamp:  time.Now(),
 			})
 			return nil
 		}
-		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error Redis: %v", err)
 		return err
 	}
 
+	// Stream upstream hanya hidup selama masih ada viewer untuk whatsappID ini
+	streamCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if watchViewers {
+		go s.cancelWhenViewersGone(streamCtx, cancel, whatsappID)
+	}
+
+	s.trackStream(whatsappID, cancel)
+	defer s.untrackStream(whatsappID)
+	defer func() { stopCause = context.Cause(streamCtx) }()
+
+	// Terima cancel dari replica lain yang tidak memegang stream ini
+	s.watchStreamControl(streamCtx, cancel, whatsappID)
+
+	// Perpanjang lease selama stream berjalan, hentikan stream jika lease diambil alih
+	go lease.keepAlive(streamCtx, cancel)
+
+	// Batasi umur session sesuai session.max_duration
+	if maxDuration := sessionMaxDuration(); maxDuration > 0 {
+		timer := time.AfterFunc(maxDuration, func() { cancel(errSessionMaxDuration) })
+		defer timer.Stop()
+	}
+
 	req := &proto.ConnectDeviceRequest{
 		Name: whatsappID,
 	}
-	stream, err := s.app.StreamConnectDevice(ctx, req)
+	// attempt adalah jumlah percobaan connect yang gagal sejak frame terakhir yang berhasil diterima
+	stream, attempt, err := s.connectStream(streamCtx, req, 0)
 	if err != nil {
-		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error calling GenerateNumbers: %v", err)
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error connecting stream for whatsappID %s: %v", whatsappID, err)
+		if streamCtx.Err() == nil {
+			s.publishStatus(ctx, whatsappID, "upstream_failed", false, err.Error())
+		}
 		return err
 	}
 
+	qrKey := fmt.Sprintf(keyQrPrefix, whatsappID)
+
+	// State machine pairing untuk stream ini, disimpan ke Redis di setiap transisi
+	machine := newPairingMachine(whatsappID)
+	s.savePairingState(ctx, model.PairingStatus{WhatsappId: whatsappID, State: machine.state, UpdatedAt: time.Now()})
+
+	// upstreamErr menyimpan error permanen yang mengakhiri stream
+	var upstreamErr error
+
+	// Catat disconnect jika stream berakhir sebelum mencapai state akhir
+	defer func() {
+		switch machine.state {
+		case model.PairingPaired, model.PairingExpired, model.PairingFailed, model.PairingLoggedOut:
+			return
+		}
+		reason := "stream closed by server"
+		if upstreamErr != nil {
+			reason = upstreamErr.Error()
+		} else if streamCtx.Err() != nil {
+			reason = context.Cause(streamCtx).Error()
+		}
+		s.applyPairingEvent(context.WithoutCancel(ctx), machine, model.AccountEventDisconnected, reason)
+	}()
+
+	// rotations adalah jumlah QR yang sudah dikirim dalam session ini
+	rotations := 0
+	maxRotations := util.Configuration.Session.MaxQRRotations
+
 	for {
 		resp, err := stream.Recv()
 		if err == io.EOF {
 			s.logger.Infofctx(provider.AppLog, ctx, "Stream closed by server")
 			break
 		}
+		if err != nil && streamCtx.Err() != nil {
+			s.logger.Infofctx(provider.AppLog, ctx, "Stream for whatsappID %s cancelled: %v", whatsappID, context.Cause(streamCtx))
+			break
+		}
 		if err != nil {
 			s.logger.Errorfctx(provider.AppLog, ctx, false, "Error receiving stream: %v", err)
+
+			if !isTransientStreamError(err) {
+				upstreamErr = err
+				s.publishStatus(ctx, whatsappID, "upstream_failed", false, err.Error())
+				break
+			}
+
+			if stream, attempt, err = s.connectStream(streamCtx, req, attempt+1); err != nil {
+				if streamCtx.Err() == nil {
+					upstreamErr = err
+					s.publishStatus(ctx, whatsappID, "upstream_failed", false, err.Error())
+				}
+				break
+			}
+			// Stream baru memulai pairing dari awal, state lama tidak lagi berlaku
+			s.applyPairingEvent(ctx, machine, model.AccountEventDisconnected, "upstream reconnected")
+			continue
+		}
+
+		if attempt > 0 {
+			s.logger.Infofctx(provider.AppLog, ctx, "Stream for whatsappID %s reconnected after %d attempt(s)", whatsappID, attempt)
+			s.publishStatus(ctx, whatsappID, "reconnected", true, fmt.Sprintf("Reconnected after %d attempt(s)", attempt))
+			attempt = 0
 		}
 
 		var message model.WSMessage
 		switch resp.Type {
 		case "qr":
+			rotations++
+			if maxRotations > 0 && rotations > maxRotations {
+				cancel(errSessionMaxQR)
+				break
+			}
+
+			state, err := s.applyPairingEvent(ctx, machine, model.AccountEventQRIssued, "")
+			if err != nil {
+				continue
+			}
+
 			message = model.WSMessage{
 				MsgStatus:  true,
 				Type:       "qr_code",
 				WhatsappId: whatsappID,
 				Data:       resp.Qr,
+				State:      state,
 				Timestamp:  time.Now(),
 			}
 			qrterminal.GenerateHalfBlock(resp.Qr, qrterminal.L, os.Stdout)
+
+			// Simpan QR terakhir untuk viewer yang bergabung belakangan
+			if err := s.redis.Set(ctx, qrKey, resp.Qr, qrSpan()).Err(); err != nil {
+				s.logger.Errorfctx(provider.AppLog, ctx, false, "Error set QR code in Redis: %v", err)
+			}
 		case "event":
+			state := machine.state
+			if event, ok := parsePairingDesc(resp.Desc); ok {
+				if state, err = s.applyPairingEvent(ctx, machine, event, resp.Desc); err != nil {
+					continue
+				}
+			} else {
+				// Deskripsi yang belum dikenal tetap diteruskan tanpa mengubah state
+				s.logger.Infofctx(provider.AppLog, ctx, "Unknown wacore event %q for whatsappID %s", resp.Desc, whatsappID)
+			}
+
+			// QR tidak lagi berlaku setelah pairing berhasil
+			if state == model.PairingPaired {
+				if err := s.redis.Del(ctx, qrKey).Err(); err != nil {
+					s.logger.Errorfctx(provider.AppLog, ctx, false, "Error delete QR code in Redis: %v", err)
+				}
+			}
+
 			message = model.WSMessage{
 				MsgStatus:  true,
 				Type:       "event_state",
 				WhatsappId: whatsappID,
 				Data:       resp.Desc,
+				State:      state,
 				Timestamp:  time.Now(),
 			}
 		default:
+			s.logger.Debugfctx(provider.AppLog, ctx, "Ignoring wacore frame type %q for whatsappID %s", resp.Type, whatsappID)
 			continue
 		}
+		// Batas session tercapai saat memproses frame ini
+		if streamCtx.Err() != nil {
+			break
+		}
 
-		if err := s.hub.EmitMessageToClient(ctx, whatsappID, message); err != nil {
-			s.logger.Errorfctx(provider.AppLog, ctx, false, "Error emitting QR code: %v", err)
+		// Publish ke Redis agar viewer di replica lain juga menerima pesan
+		if err := s.hub.PublishMessage(ctx, whatsappID, message); err != nil {
+			s.logger.Errorfctx(provider.AppLog, ctx, false, "Error publishing message: %v", err)
+		}
+	}
+
+	// Session dihentikan karena batas session, tandai expired. Restart ditawarkan
+	// ke viewer setelah lease dilepas.
+	if cause := context.Cause(streamCtx); isSessionLimit(cause) {
+		s.logger.Infofctx(provider.AppLog, ctx, "Session for whatsappID %s expired: %v", whatsappID, cause)
+		expiredState = machine.state
+		if next, err := s.applyPairingEvent(ctx, machine, model.AccountEventQRTimeout, cause.Error()); err == nil {
+			expiredState = next
 		}
 	}
 
 	return nil
 }
+
+// qrSpan mengembalikan TTL cache QR dari konfigurasi redis.qr_span
+func qrSpan() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Redis.QRSpan, defaultQRSpan)
+}
+
+// cancelWhenViewersGone membatalkan stream upstream saat whatsappID tidak lagi memiliki viewer
+// di replica mana pun. Jika session.idle_timeout diset, stream baru dibatalkan setelah tidak
+// ada viewer selama durasi tersebut.
+func (s *service) cancelWhenViewersGone(ctx context.Context, cancel context.CancelCauseFunc, whatsappID string) {
+	idleTimeout := sessionIdleTimeout()
+
+	for {
+		select {
+		case <-s.hub.ViewersGone(whatsappID):
+		case <-ctx.Done():
+			return
+		}
+
+		// Viewer lokal sudah habis, tetapi replica lain mungkin masih melayani viewer
+		if s.hasViewers(ctx, whatsappID) {
+			select {
+			case <-time.After(viewerCheckInterval):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if idleTimeout <= 0 {
+			s.logger.Infofctx(provider.AppLog, ctx, "No viewers left for whatsappID %s, cancelling upstream stream", whatsappID)
+			cancel(errNoViewers)
+			return
+		}
+
+		s.logger.Infofctx(provider.AppLog, ctx, "No viewers left for whatsappID %s, keeping upstream stream for %s", whatsappID, idleTimeout)
+		select {
+		case <-time.After(idleTimeout):
+		case <-ctx.Done():
+			return
+		}
+
+		if !s.hasViewers(ctx, whatsappID) {
+			s.logger.Infofctx(provider.AppLog, ctx, "No viewers returned for whatsappID %s, cancelling upstream stream", whatsappID)
+			cancel(errSessionIdle)
+			return
+		}
+	}
+}
+
+// hasViewers menentukan apakah whatsappID masih memiliki viewer di semua replica.
+// Jika Redis tidak bisa dibaca, viewer dianggap masih ada agar stream tidak terputus.
+func (s *service) hasViewers(ctx context.Context, whatsappID string) bool {
+	ok, err := s.hub.HasViewers(ctx, whatsappID)
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error checking viewers of %s: %v", whatsappID, err)
+		return true
+	}
+	return ok
+}
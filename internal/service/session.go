@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"qrstreamer/internal/provider"
+	"qrstreamer/model"
+	"qrstreamer/util"
+	"time"
+)
+
+var (
+	errSessionMaxDuration = errors.New("session exceeded maximum duration")
+	errSessionMaxQR       = errors.New("session exceeded maximum QR rotations")
+	errSessionIdle        = errors.New("session idle without viewers")
+)
+
+// isSessionLimit menentukan apakah cause pembatalan stream berasal dari batas session
+func isSessionLimit(cause error) bool {
+	return errors.Is(cause, errSessionMaxDuration) || errors.Is(cause, errSessionMaxQR) || errors.Is(cause, errSessionIdle)
+}
+
+// sessionMaxDuration mengembalikan batas umur session dari session.max_duration, 0 berarti tanpa batas
+func sessionMaxDuration() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Session.MaxDuration, 0)
+}
+
+// sessionIdleTimeout mengembalikan berapa lama session bertahan tanpa viewer dari session.idle_timeout
+func sessionIdleTimeout() time.Duration {
+	return util.ConfigSeconds(util.Configuration.Session.IdleTimeout, 0)
+}
+
+// publishSessionExpired memberi tahu viewer bahwa session berakhir beserta alasannya
+// dan menawarkan command restart_qr
+func (s *service) publishSessionExpired(ctx context.Context, whatsappID string, state string, cause error) {
+	err := s.hub.PublishMessage(ctx, whatsappID, model.WSMessage{
+		MsgStatus:  false,
+		Type:       "session_expired",
+		WhatsappId: whatsappID,
+		Data:       cause.Error(),
+		State:      state,
+		Actions:    []string{model.WSCommandRestartQR},
+		Timestamp:  time.Now(),
+	})
+	if err != nil {
+		s.logger.Errorfctx(provider.AppLog, ctx, false, "Error publishing session_expired message: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Jenis event siklus pairing yang dicatat ke whatsapp_account_states dan account_events
+const (
+	AccountEventQRIssued     = "qr_issued"
+	AccountEventQRScanned    = "qr_scanned"
+	AccountEventPaired       = "paired"
+	AccountEventQRTimeout    = "qr_timeout"
+	AccountEventFailed       = "failed"
+	AccountEventLoggedOut    = "logged_out"
+	AccountEventDisconnected = "disconnected"
+)
+
+// AccountEvent adalah satu kejadian siklus pairing beserta info client WebSocket
+type AccountEvent struct {
+	AccountID string    `json:"account_id"` // UUID
+	EventType string    `json:"event_type"`
+	Message   string    `json:"message,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// APIResponse adalah bentuk response JSON seluruh endpoint REST
+type APIResponse struct {
+	MsgStatus bool        `json:"msg_status"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// ClientInfo menggambarkan satu viewer yang terhubung ke Hub
+type ClientInfo struct {
+	WhatsappId  string    `json:"whatsapp_id"`
+	UserId      string    `json:"user_id,omitempty"` // hanya diisi endpoint admin
+	Transport   string    `json:"transport"`         // websocket, sse atau poll
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Dropped     uint64    `json:"dropped"` // pesan yang dibuang karena client lambat
+}
+
+// EmitRequest adalah body POST /api/emit dan /api/emit/client
+type EmitRequest struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// SendTextRequest adalah body POST /api/send-message
+type SendTextRequest struct {
+	SenderJid string `json:"sender_jid"`
+	To        string `json:"to"`
+	Message   string `json:"message"`
+}
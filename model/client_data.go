@@ -0,0 +1,18 @@
+package model
+
+import proto "qrstreamer/model/pb"
+
+// ClientDataQuery adalah parameter pencarian dan paginasi kontak/grup
+type ClientDataQuery struct {
+	Search  string // dicocokkan ke name atau short, case-insensitive
+	Page    int    // dimulai dari 1
+	PerPage int
+}
+
+// ClientDataPage adalah satu halaman hasil kontak/grup
+type ClientDataPage struct {
+	Items   []*proto.ClientdataItem `json:"items"`
+	Page    int                     `json:"page"`
+	PerPage int                     `json:"per_page"`
+	Total   int                     `json:"total"`
+}
@@ -3,4 +3,9 @@ package constant
 const (
 	ReqIDLog    = "x-request-id"
 	CtxReqIDKey = "req-id"
+	// CtxUserIDKey menyimpan user_id yang sudah diautentikasi
+	CtxUserIDKey = "user-id"
+	// CtxClientIPKey dan CtxUserAgentKey menyimpan info client WebSocket
+	CtxClientIPKey  = "client-ip"
+	CtxUserAgentKey = "user-agent"
 )
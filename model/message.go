@@ -0,0 +1,60 @@
+package model
+
+// SendMessageRequest adalah body POST /api/messages. Field yang dipakai
+// ditentukan oleh Type, field varian lain diabaikan.
+type SendMessageRequest struct {
+	SenderJid    string               `json:"sender_jid"`
+	To           string               `json:"to"`
+	Type         string               `json:"type"` // text, image, video, audio, document, location, vcard, contacts, live_location
+	Text         string               `json:"text,omitempty"`
+	Image        *MediaPayload        `json:"image,omitempty"`
+	Video        *MediaPayload        `json:"video,omitempty"`
+	Audio        *AudioPayload        `json:"audio,omitempty"`
+	Document     *DocumentPayload     `json:"document,omitempty"`
+	Location     *LocationPayload     `json:"location,omitempty"`
+	Vcard        *ContactPayload      `json:"vcard,omitempty"`
+	Contacts     []ContactPayload     `json:"contacts,omitempty"`
+	LiveLocation *LiveLocationPayload `json:"live_location,omitempty"`
+}
+
+type MediaPayload struct {
+	URL      string `json:"url"`
+	Caption  string `json:"caption,omitempty"`
+	Mimetype string `json:"mimetype,omitempty"`
+}
+
+type AudioPayload struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type,omitempty"`
+	PTT      bool   `json:"ptt,omitempty"` // true = voice note
+}
+
+type DocumentPayload struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename,omitempty"`
+	Mimetype string `json:"mimetype,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+type LocationPayload struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Name      string   `json:"name,omitempty"`
+	Address   string   `json:"address,omitempty"`
+}
+
+type ContactPayload struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+}
+
+type LiveLocationPayload struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Duration  uint32   `json:"duration,omitempty"` // dalam detik
+}
+
+// SendMessageResult adalah response POST /api/messages
+type SendMessageResult struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MessageOutbound adalah satu baris whatsapp_web.message_outbounds
+type MessageOutbound struct {
+	OutboundID  string          `json:"outbound_id"` // UUID
+	AccountID   string          `json:"account_id"`  // UUID
+	MessageID   string          `json:"message_id"`
+	Recipient   string          `json:"recipient"`
+	MessageType string          `json:"message_type"`
+	SentAt      time.Time       `json:"sent_at"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+// OutboundFilter membatasi hasil daftar pesan keluar
+type OutboundFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
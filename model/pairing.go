@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// State machine pairing per akun
+const (
+	PairingIdle         = "idle"
+	PairingAwaitingScan = "awaiting_scan"
+	PairingScanned      = "scanned"
+	PairingPaired       = "paired"
+	PairingExpired      = "expired"
+	PairingFailed       = "failed"
+	PairingLoggedOut    = "logged_out"
+)
+
+// PairingStatus adalah state pairing terakhir sebuah akun
+type PairingStatus struct {
+	WhatsappId string    `json:"whatsapp_id"`
+	State      string    `json:"state"`
+	Event      string    `json:"event,omitempty"` // event terakhir yang mengubah state
+	Desc       string    `json:"desc,omitempty"`  // deskripsi asli dari wacore
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// Command yang dapat dikirim client lewat WebSocket
+const (
+	WSCommandRestartQR   = "restart_qr"
+	WSCommandCancel      = "cancel"
+	WSCommandPing        = "ping"
+	WSCommandSubscribe   = "subscribe"
+	WSCommandUnsubscribe = "unsubscribe"
+	WSCommandGetState    = "get_state"
+)
+
+// Tipe balasan command
+const (
+	WSReplyAck   = "ack"
+	WSReplyError = "error"
+)
+
+// WSCommand adalah frame JSON yang dikirim client, mis.
+// {"request_id":"1","type":"subscribe","whatsapp_id":"628xxx"}.
+// Jika whatsapp_id kosong, command berlaku untuk wa_id koneksi.
+type WSCommand struct {
+	RequestId  string `json:"request_id"`
+	Type       string `json:"type"`
+	WhatsappId string `json:"whatsapp_id,omitempty"`
+}
+
+// WSCommandReply adalah balasan untuk satu WSCommand, dikorelasikan lewat request_id
+type WSCommandReply struct {
+	MsgStatus  bool      `json:"msg_status"`
+	Type       string    `json:"type"` // WSReplyAck atau WSReplyError
+	RequestId  string    `json:"request_id"`
+	Command    string    `json:"command"`
+	WhatsappId string    `json:"whatsapp_id,omitempty"`
+	Data       any       `json:"data,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
@@ -5,9 +5,21 @@ import (
 )
 
 type WSMessage struct {
+	Seq        int64     `json:"seq,omitempty"` // nomor urut per whatsappID, dipakai untuk ?since=
 	MsgStatus  bool      `json:"msg_status"`
 	Type       string    `json:"type"`
 	WhatsappId string    `json:"whatsapp_id"`
 	Data       string    `json:"data"`
+	State      string    `json:"state,omitempty"`   // state pairing, lihat model.Pairing*
+	PNG        string    `json:"png,omitempty"`     // data URI, hanya untuk qr_code jika diminta client
+	SVG        string    `json:"svg,omitempty"`     // data URI, hanya untuk qr_code jika diminta client
+	Actions    []string  `json:"actions,omitempty"` // command yang bisa dikirim client, mis. "restart_qr"
 	Timestamp  time.Time `json:"timestamp"`
 }
+
+// PollResponse adalah data response GET /poll. Next dikirim kembali sebagai
+// ?since= pada poll berikutnya.
+type PollResponse struct {
+	Messages []WSMessage `json:"messages"`
+	Next     int64       `json:"next"`
+}
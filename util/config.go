@@ -14,8 +14,30 @@ type Config struct {
 		Port int `mapstructure:"port"`
 	}
 	Websocket struct {
-		Port int `mapstructure:"port"`
+		Port               int      `mapstructure:"port"`
+		MaxViewers         int      `mapstructure:"max_viewers"`
+		AllowedOrigins     []string `mapstructure:"allowed_origins"`
+		PingInterval       int      `mapstructure:"ping_interval"`
+		PongWait           int      `mapstructure:"pong_wait"`
+		WriteWait          int      `mapstructure:"write_wait"`
+		MaxMessageSize     int64    `mapstructure:"max_message_size"`
+		SendBuffer         int      `mapstructure:"send_buffer"`
+		SlowConsumerPolicy string   `mapstructure:"slow_consumer_policy"`
+		ShutdownGrace      int      `mapstructure:"shutdown_grace"`
 	} `mapstructure:"websocket"`
+	Auth struct {
+		Enabled     bool   `mapstructure:"enabled"`
+		HS256Secret string `mapstructure:"hs256_secret"`
+		JWKSFile    string `mapstructure:"jwks_file"`
+		Issuer      string `mapstructure:"issuer"`
+		Audience    string `mapstructure:"audience"`
+		UserClaim   string `mapstructure:"user_claim"`
+		// DevTrustUserHeader mengizinkan user_id dari ?user_id= / User-ID saat auth
+		// dimatikan. Hanya untuk pengembangan lokal karena nilainya bisa dipalsukan.
+		DevTrustUserHeader bool `mapstructure:"dev_trust_user_header"`
+		// AdminUserIDs adalah user_id yang boleh membaca endpoint /api/admin
+		AdminUserIDs []string `mapstructure:"admin_user_ids"`
+	} `mapstructure:"auth"`
 	Logger struct {
 		Dir        string `mapstructure:"dir"`
 		FileName   string `mapstructure:"file_name"`
@@ -35,8 +57,50 @@ type Config struct {
 		Options  []string `mapstructure:"options"`
 		QRSpan   int      `mapstructure:"qr_span"`
 	} `mapstructure:"redis"`
+	Upstream struct {
+		ReconnectBaseDelayMs int               `mapstructure:"reconnect_base_delay_ms"`
+		ReconnectMaxDelayMs  int               `mapstructure:"reconnect_max_delay_ms"`
+		ReconnectMaxAttempts int               `mapstructure:"reconnect_max_attempts"`
+		PairingDescs         map[string]string `mapstructure:"pairing_descs"`
+	} `mapstructure:"upstream"`
+	Session struct {
+		MaxDuration    int `mapstructure:"max_duration"`
+		MaxQRRotations int `mapstructure:"max_qr_rotations"`
+		IdleTimeout    int `mapstructure:"idle_timeout"`
+	} `mapstructure:"session"`
+	SSE struct {
+		Heartbeat int `mapstructure:"heartbeat"`
+	} `mapstructure:"sse"`
+	Poll struct {
+		DefaultTimeout int `mapstructure:"default_timeout"`
+		MaxTimeout     int `mapstructure:"max_timeout"`
+		Linger         int `mapstructure:"linger"`
+	} `mapstructure:"poll"`
+	Replay struct {
+		BufferSize  int  `mapstructure:"buffer_size"`
+		TTL         int  `mapstructure:"ttl"`
+		RedisStream bool `mapstructure:"redis_stream"`
+	} `mapstructure:"replay"`
+	Postgres struct {
+		Host     string   `mapstructure:"host"`
+		Port     int      `mapstructure:"port"`
+		Username string   `mapstructure:"username"`
+		Password string   `mapstructure:"password"`
+		Database string   `mapstructure:"database"`
+		Options  []string `mapstructure:"options"`
+		MaxConns int      `mapstructure:"max_conns"`
+	} `mapstructure:"postgres"`
+	QRImage struct {
+		Size          int    `mapstructure:"size"`
+		Level         string `mapstructure:"level"`
+		QuietZone     int    `mapstructure:"quiet_zone"`
+		Wait          int    `mapstructure:"wait"`
+		StreamTimeout int    `mapstructure:"stream_timeout"`
+	} `mapstructure:"qr_image"`
 	Cache struct {
-		WSStream int `mapstructure:"wsstream"`
+		WSStream   int `mapstructure:"wsstream"`
+		ClientData int `mapstructure:"client_data"`
+		Account    int `mapstructure:"account"`
 	} `mapstructure:"cache"`
 }
 
@@ -28,3 +28,11 @@ func CreateDirectory(paths ...string) (err error) {
 	}
 	return
 }
+
+// ConfigSeconds converts a config value in seconds to a duration, returns def if unset
+func ConfigSeconds(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const (
+	defaultQRImageSize      = 256
+	defaultQRImageQuietZone = 4
+)
+
+// QRImageOptions mengatur ukuran, level koreksi error dan quiet zone gambar QR
+type QRImageOptions struct {
+	Size      int    // lebar/tinggi gambar dalam pixel
+	Level     string // L, M, Q atau H
+	QuietZone int    // jumlah modul kosong di setiap sisi
+}
+
+// QRImageOptionsFromConfig membaca opsi render QR dari konfigurasi qr_image
+func QRImageOptionsFromConfig() QRImageOptions {
+	return QRImageOptions{
+		Size:      Configuration.QRImage.Size,
+		Level:     Configuration.QRImage.Level,
+		QuietZone: Configuration.QRImage.QuietZone,
+	}
+}
+
+func (o QRImageOptions) level() qr.Level {
+	switch strings.ToUpper(o.Level) {
+	case "L":
+		return qr.L
+	case "Q":
+		return qr.Q
+	case "H":
+		return qr.H
+	default:
+		return qr.M
+	}
+}
+
+func (o QRImageOptions) quietZone() int {
+	if o.QuietZone <= 0 {
+		return defaultQRImageQuietZone
+	}
+	return o.QuietZone
+}
+
+// scale menghitung ukuran pixel per modul agar gambar mendekati Size
+func (o QRImageOptions) scale(modules int) int {
+	size := o.Size
+	if size <= 0 {
+		size = defaultQRImageSize
+	}
+	scale := size / (modules + 2*o.quietZone())
+	if scale < 1 {
+		scale = 1
+	}
+	return scale
+}
+
+// RenderQRPNG merender teks QR menjadi gambar PNG
+func RenderQRPNG(text string, opt QRImageOptions) ([]byte, error) {
+	code, err := qr.Encode(text, opt.level())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr: %w", err)
+	}
+
+	quiet := opt.quietZone()
+	scale := opt.scale(code.Size)
+	dim := (code.Size + 2*quiet) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, dim, dim), color.Palette{color.White, color.Black})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quiet)*scale+dx, (y+quiet)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderQRSVG merender teks QR menjadi dokumen SVG
+func RenderQRSVG(text string, opt QRImageOptions) ([]byte, error) {
+	code, err := qr.Encode(text, opt.level())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr: %w", err)
+	}
+
+	quiet := opt.quietZone()
+	scale := opt.scale(code.Size)
+	modules := code.Size + 2*quiet
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, modules*scale, modules*scale, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
+
+// DataURI membungkus data biner menjadi data URI base64
+func DataURI(mimeType string, data []byte) string {
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+}